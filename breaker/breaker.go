@@ -0,0 +1,419 @@
+// Package breaker provides a circuit breaker for outbound dependencies.
+//
+// A closed breaker lets calls through and counts failures over a sliding
+// window. Once the failure ratio crosses the threshold the breaker opens and
+// rejects calls with ErrOpen. After OpenTimeout it lets a limited number of
+// probes through (half-open) and closes again once they all succeed.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpen is returned while the breaker rejects calls
+	ErrOpen = errors.New("breaker: circuit open")
+	// ErrTooManyProbes is returned in half-open state when all probes are in flight
+	ErrTooManyProbes = errors.New("breaker: too many probes")
+)
+
+// State of a breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Config holds breaker configuration
+type Config struct {
+	// Length of the sliding window failures are counted over
+	Window time.Duration
+	// Number of buckets the window is split into
+	Buckets int
+	// Minimum calls in the window before the breaker may open
+	MinRequests int
+	// Failure ratio in the window that opens the breaker, e.g. 0.5
+	FailureRatio float64
+	// Time the breaker stays open before probing
+	OpenTimeout time.Duration
+	// Concurrent probes in half-open state, all must succeed to close
+	HalfOpenProbes int
+	// IsFailure classifies errors (default: non-nil errors).
+	// Calls canceled by the caller count neither as success nor failure.
+	IsFailure func(error) bool
+	// IsFailureStatus classifies HTTP responses (default: status >= 500)
+	IsFailureStatus func(status int) bool
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Window:         10 * time.Second,
+		Buckets:        10,
+		MinRequests:    20,
+		FailureRatio:   0.5,
+		OpenTimeout:    30 * time.Second,
+		HalfOpenProbes: 1,
+		IsFailure: func(err error) bool {
+			return err != nil
+		},
+		IsFailureStatus: func(status int) bool {
+			return status >= http.StatusInternalServerError
+		},
+	}
+}
+
+// Breaker is a circuit breaker for one dependency
+type Breaker struct {
+	name   string
+	logger *slog.Logger
+	config *Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	state   State
+	changed time.Time
+	buckets []bucket
+	// generation changes with every state change so calls started in an
+	// earlier state don't count towards the current one
+	generation uint64
+	probes     int
+	successes  int
+}
+
+type bucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+// New creates a breaker, name identifies the dependency in logs and Status
+func New(name string, logger *slog.Logger, config *Config) *Breaker {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	defaults := DefaultConfig()
+	if config.Buckets <= 0 {
+		config.Buckets = defaults.Buckets
+	}
+	if config.Window <= 0 {
+		config.Window = defaults.Window
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = defaults.IsFailure
+	}
+	if config.IsFailureStatus == nil {
+		config.IsFailureStatus = defaults.IsFailureStatus
+	}
+
+	return &Breaker{
+		name:    name,
+		logger:  logger,
+		config:  config,
+		now:     time.Now,
+		changed: time.Now(),
+		buckets: make([]bucket, config.Buckets),
+	}
+}
+
+// Name returns the dependency name
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Do calls fn unless the breaker is open and records its outcome
+func (b *Breaker) Do(fn func() error) error {
+	done, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// A panic must not leave a half-open probe in flight forever
+		if r := recover(); r != nil {
+			done(outcomeFailure)
+			panic(r)
+		}
+	}()
+
+	err = fn()
+	done(b.outcome(err))
+	return err
+}
+
+// Call is Do for functions returning a value
+func Call[T any](b *Breaker, fn func() (T, error)) (T, error) {
+	var result T
+	err := b.Do(func() error {
+		var err error
+		result, err = fn()
+		return err
+	})
+	return result, err
+}
+
+// outcome of a call
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored releases a probe slot without counting the call,
+	// e.g. when the caller canceled it
+	outcomeIgnored
+)
+
+// outcome classifies the error returned by a call
+func (b *Breaker) outcome(err error) outcome {
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The caller gave up, that says nothing about the dependency
+		return outcomeIgnored
+	case b.config.IsFailure(err):
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+// Allow reports whether a call may proceed. If so, done must be called
+// exactly once with the outcome of the call.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	release, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(success bool) {
+		if success {
+			release(outcomeSuccess)
+			return
+		}
+		release(outcomeFailure)
+	}, nil
+}
+
+func (b *Breaker) allow() (done func(outcome), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	if b.state == StateOpen {
+		if now.Sub(b.changed) < b.config.OpenTimeout {
+			return nil, ErrOpen
+		}
+		b.setState(StateHalfOpen, now)
+	}
+
+	if b.state == StateHalfOpen {
+		if b.probes >= b.config.HalfOpenProbes {
+			return nil, ErrTooManyProbes
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(o outcome) {
+		once.Do(func() { b.record(generation, o) })
+	}, nil
+}
+
+func (b *Breaker) record(generation uint64, o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	now := b.now()
+	success := o == outcomeSuccess
+
+	switch b.state {
+	case StateHalfOpen:
+		if o == outcomeIgnored {
+			b.probes--
+			return
+		}
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenProbes {
+			b.setState(StateClosed, now)
+		}
+
+	case StateClosed:
+		if o == outcomeIgnored {
+			return
+		}
+		bk := b.bucket(now)
+		if success {
+			bk.successes++
+			return
+		}
+		bk.failures++
+
+		successes, failures := b.counts(now)
+		total := successes + failures
+		if total >= b.config.MinRequests && float64(failures)/float64(total) >= b.config.FailureRatio {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+// bucket returns the current bucket, b.mu must be held
+func (b *Breaker) bucket(now time.Time) *bucket {
+	epoch := b.epoch(now)
+	bk := &b.buckets[epoch%int64(len(b.buckets))]
+	if bk.epoch != epoch {
+		*bk = bucket{epoch: epoch}
+	}
+	return bk
+}
+
+// counts sums the buckets in the window, b.mu must be held
+func (b *Breaker) counts(now time.Time) (successes, failures int) {
+	epoch := b.epoch(now)
+	n := int64(len(b.buckets))
+	for _, bk := range b.buckets {
+		if bk.epoch > epoch-n && bk.epoch <= epoch {
+			successes += bk.successes
+			failures += bk.failures
+		}
+	}
+	return successes, failures
+}
+
+func (b *Breaker) epoch(now time.Time) int64 {
+	size := int64(b.config.Window) / int64(len(b.buckets))
+	if size <= 0 {
+		size = 1
+	}
+	return now.UnixNano() / size
+}
+
+// setState switches state and resets counters, b.mu must be held
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+
+	b.state = state
+	b.changed = now
+	b.generation++
+	b.probes = 0
+	b.successes = 0
+	if state == StateClosed {
+		clear(b.buckets)
+	}
+
+	level := slog.LevelWarn
+	if state == StateClosed {
+		level = slog.LevelInfo
+	}
+	b.logger.Log(context.Background(), level, "breaker state changed",
+		slog.String("breaker", b.name),
+		slog.String("from", from.String()),
+		slog.String("to", state.String()),
+	)
+}
+
+// State returns the current state. An open breaker whose timeout expired
+// still reports open until the next call probes the dependency.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Degraded reports whether the dependency is not fully available
+func (b *Breaker) Degraded() bool {
+	return b.State() != StateClosed
+}
+
+// Status is a snapshot of a breaker, e.g. for a health endpoint
+type Status struct {
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Since    time.Time `json:"since"`
+	Requests int       `json:"requests"`
+	Failures int       `json:"failures"`
+}
+
+// Status returns a snapshot of the breaker
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	successes, failures := b.counts(b.now())
+	return Status{
+		Name:     b.name,
+		State:    b.state.String(),
+		Since:    b.changed,
+		Requests: successes + failures,
+		Failures: failures,
+	}
+}
+
+// RoundTripper wraps base so requests fail fast with ErrOpen while the
+// breaker is open. Transport errors and IsFailureStatus responses count as failures.
+func (b *Breaker) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{breaker: b, base: base}
+}
+
+type transport struct {
+	breaker *Breaker
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.breaker.allow()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		done(t.breaker.outcome(err))
+		return nil, err
+	}
+
+	if t.breaker.config.IsFailureStatus(resp.StatusCode) {
+		done(outcomeFailure)
+	} else {
+		done(outcomeSuccess)
+	}
+	return resp, nil
+}
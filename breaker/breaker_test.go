@@ -0,0 +1,189 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+func newTestBreaker(config *Config) (*Breaker, *time.Time) {
+	b := New("test", slog.New(slog.NewTextHandler(io.Discard, nil)), config)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestStateTransitions(t *testing.T) {
+	b, now := newTestBreaker(&Config{
+		Window:         10 * time.Second,
+		Buckets:        10,
+		MinRequests:    4,
+		FailureRatio:   0.5,
+		OpenTimeout:    5 * time.Second,
+		HalfOpenProbes: 2,
+	})
+
+	ok := func() error { return nil }
+	fail := func() error { return errDown }
+
+	// 1 of 3 fails, below MinRequests
+	b.Do(ok)
+	b.Do(ok)
+	b.Do(fail)
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed, got %s", b.State())
+	}
+
+	// 2 of 4 fails, opens
+	b.Do(fail)
+	if b.State() != StateOpen {
+		t.Fatalf("Expected open, got %s", b.State())
+	}
+	if err := b.Do(ok); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Expected ErrOpen, got %v", err)
+	}
+
+	// After OpenTimeout two probes are let through, a third is rejected
+	*now = now.Add(5 * time.Second)
+	done1, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Expected probe, got %v", err)
+	}
+	done2, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Expected probe, got %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrTooManyProbes) {
+		t.Fatalf("Expected ErrTooManyProbes, got %v", err)
+	}
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open, got %s", b.State())
+	}
+
+	// A failed probe opens again
+	done1(true)
+	done2(false)
+	if b.State() != StateOpen {
+		t.Fatalf("Expected open after failed probe, got %s", b.State())
+	}
+
+	// Successful probes close
+	*now = now.Add(5 * time.Second)
+	b.Do(ok)
+	b.Do(ok)
+	if b.State() != StateClosed {
+		t.Fatalf("Expected closed, got %s", b.State())
+	}
+	if status := b.Status(); status.Requests != 0 {
+		t.Errorf("Expected a fresh window after closing, got %+v", status)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	b, now := newTestBreaker(&Config{
+		Window:       10 * time.Second,
+		Buckets:      10,
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		OpenTimeout:  time.Minute,
+	})
+
+	for range 3 {
+		b.Do(func() error { return errDown })
+	}
+
+	// The old failures slide out of the window
+	*now = now.Add(11 * time.Second)
+	b.Do(func() error { return errDown })
+
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed, got %s", b.State())
+	}
+	if status := b.Status(); status.Requests != 1 || status.Failures != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestCanceledIsNeutral(t *testing.T) {
+	b, now := newTestBreaker(&Config{
+		MinRequests:    2,
+		FailureRatio:   0.5,
+		OpenTimeout:    5 * time.Second,
+		HalfOpenProbes: 1,
+		// No special case for cancellation, the breaker handles it
+		IsFailure: func(err error) bool { return err != nil },
+	})
+	canceled := func() error { return fmt.Errorf("query: %w", context.Canceled) }
+
+	b.Do(canceled)
+	b.Do(canceled)
+	if status := b.Status(); status.Requests != 0 {
+		t.Fatalf("Expected canceled calls not to count, got %+v", status)
+	}
+
+	// Open the breaker and let the single probe be canceled
+	b.Do(func() error { return errDown })
+	b.Do(func() error { return errDown })
+	*now = now.Add(5 * time.Second)
+
+	b.Do(canceled)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("Expected half-open after canceled probe, got %s", b.State())
+	}
+
+	// The probe slot is free again
+	if err := b.Do(func() error { return nil }); err != nil {
+		t.Fatalf("Expected probe, got %v", err)
+	}
+	if b.State() != StateClosed {
+		t.Errorf("Expected closed, got %s", b.State())
+	}
+}
+
+func TestRoundTripperCanceled(t *testing.T) {
+	b, _ := newTestBreaker(&Config{MinRequests: 1, FailureRatio: 0.5, OpenTimeout: time.Minute})
+	c := &http.Client{Transport: b.RoundTripper(http.DefaultTransport)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:1", nil)
+	if _, err := c.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if b.State() != StateClosed || b.Status().Requests != 0 {
+		t.Errorf("Expected canceled request not to count, got %+v", b.Status())
+	}
+}
+
+func TestRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b, _ := newTestBreaker(&Config{Window: time.Minute, MinRequests: 2, FailureRatio: 1, OpenTimeout: time.Minute})
+	c := &http.Client{Transport: b.RoundTripper(nil)}
+
+	for range 2 {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if _, err := c.Get(srv.URL); !errors.Is(err, ErrOpen) {
+		t.Errorf("Expected ErrOpen, got %v", err)
+	}
+	if !b.Degraded() {
+		t.Error("Expected breaker to be degraded")
+	}
+}
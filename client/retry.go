@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/tracing"
+)
+
+// IdempotencyKeyHeader makes non-idempotent requests like POST retryable
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryConfig holds retry configuration
+type RetryConfig struct {
+	// Underlying transport, e.g. NewTransport (default: http.DefaultTransport)
+	Base http.RoundTripper
+	// Maximum number of attempts including the first one
+	MaxAttempts int
+	// Backoff is a random delay up to BaseDelay * 2^retry, capped at MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Response statuses that are retried
+	RetryStatuses []int
+	// Per host retry budget: within BudgetWindow, retries are allowed up to
+	// BudgetMinRetries plus BudgetRatio of the requests sent to that host
+	BudgetRatio      float64
+	BudgetMinRetries int
+	BudgetWindow     time.Duration
+}
+
+// DefaultRetryConfig returns sensible defaults
+func DefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		RetryStatuses: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		BudgetRatio:      0.1,
+		BudgetMinRetries: 10,
+		BudgetWindow:     10 * time.Second,
+	}
+}
+
+// Retry is an http.RoundTripper that retries failed idempotent requests
+type Retry struct {
+	logger *slog.Logger
+	config *RetryConfig
+	base   http.RoundTripper
+
+	mu      sync.Mutex
+	budgets map[string]*budget
+}
+
+// NewRetry creates a retrying transport
+func NewRetry(logger *slog.Logger, config *RetryConfig) *Retry {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if config == nil {
+		config = DefaultRetryConfig()
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+
+	base := config.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Retry{
+		logger:  logger,
+		config:  config,
+		base:    base,
+		budgets: make(map[string]*budget),
+	}
+}
+
+// RoundTrip sends req and retries on transport errors and retryable statuses
+func (rt *Retry) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	budget := rt.budget(req.URL.Host)
+	budget.request(rt.config)
+
+	retryable := isIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+	for attempt := 1; ; attempt++ {
+		out := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out = req.Clone(ctx)
+			out.Body = body
+		}
+
+		resp, err := rt.base.RoundTrip(out)
+		if !retryable || attempt >= rt.config.MaxAttempts || !rt.shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := rt.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if after > rt.config.MaxDelay {
+					// The server asks for more patience than we have
+					return resp, nil
+				}
+				delay = max(delay, after)
+			}
+		}
+
+		if !budget.withdraw(rt.config) {
+			rt.logger.Warn("outbound retry budget exhausted",
+				slog.String("trace_id", traceIDFromContext(ctx)),
+				slog.String("method", req.Method),
+				slog.String("host", req.URL.Host),
+				slog.String("path", req.URL.Path),
+				slog.Int("attempt", attempt),
+			)
+			return resp, err
+		}
+
+		attrs := []slog.Attr{
+			slog.String("trace_id", traceIDFromContext(ctx)),
+			slog.String("method", req.Method),
+			slog.String("host", req.URL.Host),
+			slog.String("path", req.URL.Path),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		} else {
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			// Drain so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		rt.logger.LogAttrs(ctx, slog.LevelWarn, "outbound retry", attrs...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (rt *Retry) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		// Responses that were too large won't get smaller
+		return !errors.Is(err, ErrBodyTooLarge)
+	}
+	return slices.Contains(rt.config.RetryStatuses, resp.StatusCode)
+}
+
+// backoff returns a random delay with full jitter for the given retry
+func (rt *Retry) backoff(attempt int) time.Duration {
+	ceiling := rt.config.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := rt.config.BaseDelay << shift; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+func (rt *Retry) budget(host string) *budget {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	b, ok := rt.budgets[host]
+	if !ok {
+		b = &budget{}
+		rt.budgets[host] = b
+	}
+	return b
+}
+
+// budget counts requests and retries to one host in the current window
+type budget struct {
+	mu       sync.Mutex
+	start    time.Time
+	requests int
+	retries  int
+}
+
+func (b *budget) request(config *RetryConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll(config)
+	b.requests++
+}
+
+func (b *budget) withdraw(config *RetryConfig) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll(config)
+	allowed := config.BudgetMinRetries + int(config.BudgetRatio*float64(b.requests))
+	if b.retries >= allowed {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// roll starts a new window once the current one is over, b.mu must be held
+func (b *budget) roll(config *RetryConfig) {
+	now := time.Now()
+	if config.BudgetWindow > 0 && now.Sub(b.start) > config.BudgetWindow {
+		b.start = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// isIdempotent reports whether req may be sent more than once
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// retryAfter parses Retry-After on 429 and 503 responses
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func traceIDFromContext(ctx context.Context) string {
+	if sc := tracing.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		return sc.TraceID.String()
+	}
+	traceID, _ := ctx.Value(middleware.TraceIDKey).(string)
+	return traceID
+}
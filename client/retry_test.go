@@ -0,0 +1,170 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky fails the first n requests with status
+func flaky(n int32, status int, header http.Header) (*httptest.Server, *atomic.Int32, *atomic.Value) {
+	var calls atomic.Int32
+	var lastBody atomic.Value
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+
+		if calls.Add(1) <= n {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	return srv, &calls, &lastBody
+}
+
+func testRetryConfig() *RetryConfig {
+	config := DefaultRetryConfig()
+	config.BaseDelay = time.Millisecond
+	config.MaxDelay = 10 * time.Millisecond
+	return config
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		header    http.Header
+		failures  int32
+		status    int
+		wantCalls int32
+		wantCode  int
+	}{
+		{"GET recovers", http.MethodGet, nil, 2, http.StatusServiceUnavailable, 3, http.StatusOK},
+		{"GET gives up", http.MethodGet, nil, 5, http.StatusBadGateway, 3, http.StatusBadGateway},
+		{"no retry on 500", http.MethodGet, nil, 1, http.StatusInternalServerError, 1, http.StatusInternalServerError},
+		{"POST not retried", http.MethodPost, nil, 1, http.StatusServiceUnavailable, 1, http.StatusServiceUnavailable},
+		{"POST with idempotency key", http.MethodPost, http.Header{IdempotencyKeyHeader: {"abc"}}, 1, http.StatusServiceUnavailable, 2, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls, lastBody := flaky(tt.failures, tt.status, nil)
+			defer srv.Close()
+
+			c := &http.Client{Transport: NewRetry(discard, testRetryConfig())}
+
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("payload"))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, resp.StatusCode)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, got)
+			}
+			if got := lastBody.Load(); got != "payload" {
+				t.Errorf("Expected body to be replayed, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv, calls, _ := flaky(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+	defer srv.Close()
+
+	config := testRetryConfig()
+	config.MaxDelay = 2 * time.Second
+	c := &http.Client{Transport: NewRetry(discard, config)}
+
+	start := time.Now()
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("Expected success after 2 calls, got %d after %d", resp.StatusCode, calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected Retry-After to delay the retry, took %s", elapsed)
+	}
+
+	// Longer than MaxDelay returns the response right away
+	srv2, calls2, _ := flaky(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"120"}})
+	defer srv2.Close()
+
+	resp, err = c.Get(srv2.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || calls2.Load() != 1 {
+		t.Errorf("Expected 503 without retry, got %d after %d calls", resp.StatusCode, calls2.Load())
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	srv, calls, _ := flaky(1000, http.StatusServiceUnavailable, nil)
+	defer srv.Close()
+
+	config := testRetryConfig()
+	config.MaxAttempts = 5
+	config.BudgetMinRetries = 3
+	config.BudgetRatio = 0
+	c := &http.Client{Transport: NewRetry(discard, config)}
+
+	for range 3 {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// 3 requests plus 3 retries, the budget stops all further retries
+	if got := calls.Load(); got != 6 {
+		t.Errorf("Expected 6 calls, got %d", got)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryTransportError(t *testing.T) {
+	var calls atomic.Int32
+
+	config := testRetryConfig()
+	config.Base = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return nil, io.ErrUnexpectedEOF
+	})
+	c := &http.Client{Transport: NewRetry(discard, config)}
+
+	if _, err := c.Get("http://example.com"); err == nil {
+		t.Error("Expected an error")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+}
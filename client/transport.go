@@ -0,0 +1,217 @@
+// Package client provides http.RoundTrippers for outbound calls.
+//
+// Transport continues the trace of the incoming request, logs every call in
+// the same shape as middleware.LogRequest, applies per-host timeouts and
+// limits the size of response bodies.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/tracing"
+)
+
+// TraceIDHeader carries the plain trace ID, middleware.LogRequest reads it
+const TraceIDHeader = "X-Trace-Id"
+
+// ErrBodyTooLarge is returned when a response exceeds MaxResponseSize
+var ErrBodyTooLarge = errors.New("client: response body too large")
+
+// Config holds transport configuration
+type Config struct {
+	// Underlying transport (default: http.DefaultTransport)
+	Base http.RoundTripper
+	// Timeout per request including reading the body, 0 disables it
+	Timeout time.Duration
+	// Per host timeouts keyed by URL host, e.g. "api.example.com:8443"
+	HostTimeouts map[string]time.Duration
+	// Maximum response body size in bytes, 0 disables the limit
+	MaxResponseSize int64
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Timeout:         30 * time.Second,
+		MaxResponseSize: 10 << 20, // 10MB
+	}
+}
+
+// Transport is an http.RoundTripper for calls to other services
+type Transport struct {
+	logger *slog.Logger
+	config *Config
+	base   http.RoundTripper
+}
+
+// NewTransport creates a transport
+func NewTransport(logger *slog.Logger, config *Config) *Transport {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	base := config.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		logger: logger,
+		config: config,
+		base:   base,
+	}
+}
+
+// New returns an http.Client using a Transport
+func New(logger *slog.Logger, config *Config) *http.Client {
+	return &http.Client{Transport: NewTransport(logger, config)}
+}
+
+// RoundTrip sends req with trace headers and logs the outcome
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := req.Context()
+
+	cancel := context.CancelFunc(func() {})
+	if timeout := t.timeout(req.URL.Host); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	ctx, span := tracing.Start(ctx, req.Method,
+		tracing.WithKind(tracing.KindClient),
+		tracing.WithAttributes(
+			slog.String("http.request.method", req.Method),
+			slog.String("server.address", req.URL.Hostname()),
+			slog.String("url.full", req.URL.Redacted()),
+		),
+	)
+
+	// A RoundTripper must not modify the caller's request
+	out := req.Clone(ctx)
+	traceID := propagate(out, span)
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		cancel()
+		span.RecordError(err)
+		span.End()
+		t.logger.Error("outbound request failed",
+			slog.String("trace_id", traceID),
+			slog.String("method", req.Method),
+			slog.String("host", req.URL.Host),
+			slog.String("path", req.URL.Path),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("error", err.Error()),
+		)
+		return nil, err
+	}
+
+	span.SetAttributes(slog.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(tracing.StatusError, http.StatusText(resp.StatusCode))
+	}
+	span.End()
+
+	t.logger.Info("outbound request",
+		slog.String("trace_id", traceID),
+		slog.String("method", req.Method),
+		slog.String("host", req.URL.Host),
+		slog.String("path", req.URL.Path),
+		slog.Int("status", resp.StatusCode),
+		slog.Int64("size", resp.ContentLength),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	limit := t.config.MaxResponseSize
+	if limit > 0 && resp.ContentLength > limit {
+		resp.Body.Close()
+		cancel()
+		return nil, ErrBodyTooLarge
+	}
+
+	resp.Body = &body{ReadCloser: resp.Body, cancel: cancel, remaining: limit, limited: limit > 0}
+	return resp, nil
+}
+
+func (t *Transport) timeout(host string) time.Duration {
+	if timeout, ok := t.config.HostTimeouts[host]; ok {
+		return timeout
+	}
+	return t.config.Timeout
+}
+
+// propagate sets the trace headers on req and returns the trace ID
+func propagate(req *http.Request, span *tracing.Span) string {
+	if sc := span.SpanContext(); sc.IsValid() {
+		traceID := sc.TraceID.String()
+		req.Header.Set(tracing.TraceparentHeader, sc.Traceparent())
+		req.Header.Set(TraceIDHeader, traceID)
+		return traceID
+	}
+
+	traceID, ok := req.Context().Value(middleware.TraceIDKey).(string)
+	if !ok || traceID == "" {
+		return ""
+	}
+	req.Header.Set(TraceIDHeader, traceID)
+
+	// Without a tracer, still start a W3C trace if the ID has the right shape
+	if id, ok := tracing.ParseTraceID(traceID); ok && req.Header.Get(tracing.TraceparentHeader) == "" {
+		var spanID [8]byte
+		rand.Read(spanID[:])
+		req.Header.Set(tracing.TraceparentHeader, "00-"+id.String()+"-"+hex.EncodeToString(spanID[:])+"-01")
+	}
+
+	return traceID
+}
+
+// body releases the timeout on Close and enforces the size limit
+type body struct {
+	io.ReadCloser
+	cancel    context.CancelFunc
+	remaining int64
+	limited   bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if !b.limited {
+		return b.ReadCloser.Read(p)
+	}
+
+	if b.remaining <= 0 {
+		// Distinguish a body of exactly the limit from a larger one
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *body) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/tracing"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestPropagatesTrace(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	c := New(discard, nil)
+
+	t.Run("trace id", func(t *testing.T) {
+		traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+		ctx := context.WithValue(context.Background(), middleware.TraceIDKey, traceID)
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+
+		if got.Get(TraceIDHeader) != traceID {
+			t.Errorf("Expected %s %s, got %q", TraceIDHeader, traceID, got.Get(TraceIDHeader))
+		}
+		sc, ok := tracing.ParseTraceparent(got.Get(tracing.TraceparentHeader))
+		if !ok || sc.TraceID.String() != traceID {
+			t.Errorf("Expected traceparent for %s, got %q", traceID, got.Get(tracing.TraceparentHeader))
+		}
+		if req.Header.Get(TraceIDHeader) != "" {
+			t.Error("Expected the caller's request to be unchanged")
+		}
+	})
+
+	t.Run("span", func(t *testing.T) {
+		tracer := tracing.New(discard, &tracing.Config{ServiceName: "test"})
+		defer tracer.Shutdown(context.Background())
+
+		ctx, span := tracer.Start(context.Background(), "parent")
+		defer span.End()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+
+		sc, ok := tracing.ParseTraceparent(got.Get(tracing.TraceparentHeader))
+		if !ok || sc.TraceID != span.SpanContext().TraceID {
+			t.Fatalf("Expected traceparent in trace %s, got %q", span.SpanContext().TraceID, got.Get(tracing.TraceparentHeader))
+		}
+		if sc.SpanID == span.SpanContext().SpanID {
+			t.Error("Expected a client span as parent of the downstream call")
+		}
+	})
+}
+
+func TestHostTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	c := New(discard, &Config{HostTimeouts: map[string]time.Duration{host: 20 * time.Millisecond}})
+
+	_, err := c.Get(srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flush first so the response is chunked without Content-Length
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("a", 100))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		limit   int64
+		wantErr error
+	}{
+		{100, nil},
+		{99, ErrBodyTooLarge},
+	}
+
+	for _, tt := range tests {
+		c := New(discard, &Config{MaxResponseSize: tt.limit})
+
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("limit %d: expected %v, got %v", tt.limit, tt.wantErr, err)
+		}
+	}
+}
+
+// stallReader returns its data, then 0, nil before more data
+type stallReader struct {
+	chunks []string
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	return copy(p, chunk), nil
+}
+
+func (r *stallReader) Close() error { return nil }
+
+func TestBodyLimitProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		want    string
+		wantErr error
+	}{
+		// The probe must not fall through to an unlimited read
+		{"empty probe", []string{"abcd", "", "efgh"}, "abcd", nil},
+		{"larger", []string{"abcd", "e"}, "abcd", ErrBodyTooLarge},
+		{"exact", []string{"abcd"}, "abcd", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &body{ReadCloser: &stallReader{chunks: tt.chunks}, cancel: func() {}, remaining: 4, limited: true}
+
+			got, err := io.ReadAll(b)
+			if string(got) != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadAll() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Command replay sends a recording made by the recorder middleware against a
+// server and prints every response that differs from the recording.
+//
+// Usage:
+//
+//	replay -file traffic.jsonl -base-url http://localhost:8080
+//
+// The exit code is 1 if any response differs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/bit8bytes/toolbox/replay"
+)
+
+func main() {
+	var (
+		file          = flag.String("file", "", "JSON Lines recording (default stdin)")
+		baseURL       = flag.String("base-url", "http://localhost:8080", "server to replay against")
+		timeout       = flag.Duration("timeout", 30*time.Second, "timeout per request")
+		ignoreHeaders = flag.String("ignore-headers", "", "comma separated extra headers to ignore")
+		ignorePaths   = flag.String("ignore-json", "", "comma separated JSON body paths to ignore")
+		verbose       = flag.Bool("v", false, "print matching exchanges too")
+	)
+	flag.Parse()
+
+	in := os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	exchanges, err := replay.Read(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	config := replay.DefaultConfig()
+	config.BaseURL = *baseURL
+	config.Client.Timeout = *timeout
+	config.IgnoreHeaders = append(config.IgnoreHeaders, split(*ignoreHeaders)...)
+	config.IgnoreJSONPaths = split(*ignorePaths)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	failed := 0
+	for _, res := range replay.Run(ctx, exchanges, config) {
+		req := res.Exchange.Request
+		if res.OK() {
+			if *verbose {
+				fmt.Printf("OK   %s %s\n", req.Method, req.URL)
+			}
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL %s %s (trace_id %s)\n", req.Method, req.URL, res.Exchange.TraceID)
+		if res.Err != nil {
+			fmt.Printf("     error: %v\n", res.Err)
+		}
+		for _, diff := range res.Diffs {
+			fmt.Printf("     %s\n", diff)
+		}
+	}
+
+	fmt.Printf("%d exchanges, %d differ\n", len(exchanges), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func split(list string) []string {
+	var out []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,339 @@
+// Package accesslog provides Apache/NCSA style access log middleware
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Predefined Apache log formats
+const (
+	CommonFormat   = `%h %l %u %t "%r" %>s %b`
+	CombinedFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+)
+
+// Config holds access log configuration
+type Config struct {
+	// Apache mod_log_config format string, e.g. CommonFormat
+	//
+	// Supported directives: %h %a %l %u %t %r %m %U %q %H %s %>s %b %B
+	// %D %T %{Header}i %{Header}o %{trace_id}x and %%
+	// %{trace_id}x only works when the access log runs after LogRequest
+	Format string
+	// Destination of the log lines, e.g. a *rotate.Writer
+	Output io.Writer
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Format: CommonFormat,
+		Output: os.Stdout,
+	}
+}
+
+// New creates access log middleware with custom config.
+// It panics if the format contains an unknown directive.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+
+	format, err := Parse(config.Format)
+	if err != nil {
+		panic(err)
+	}
+
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			wrapped := middleware.NewResponseWriter(w)
+
+			next.ServeHTTP(wrapped, r)
+
+			entry := &Entry{
+				Request:  r,
+				Header:   wrapped.Header(),
+				Status:   wrapped.StatusCode(),
+				Size:     wrapped.Size(),
+				Start:    start,
+				Duration: time.Since(start),
+			}
+
+			line := format.Append(nil, entry)
+			line = append(line, '\n')
+
+			// Write the line at once so concurrent requests don't interleave
+			mu.Lock()
+			config.Output.Write(line)
+			mu.Unlock()
+		})
+	}
+}
+
+// Handler creates access log middleware in Common Log Format to stdout
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+// Combined creates access log middleware in Combined Log Format
+func Combined(mw *middleware.Middleware, out io.Writer) middleware.MiddlewareFunc {
+	return New(mw, &Config{Format: CombinedFormat, Output: out})
+}
+
+// Entry holds everything a format directive may print
+type Entry struct {
+	Request  *http.Request
+	Header   http.Header // response header
+	Status   int
+	Size     int
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Format is a compiled log format
+type Format struct {
+	parts []part
+}
+
+type part func(buf []byte, e *Entry) []byte
+
+// Parse compiles an Apache log format string
+func Parse(format string) (*Format, error) {
+	f := &Format{}
+	literal := []byte{}
+
+	flush := func() {
+		if len(literal) == 0 {
+			return
+		}
+		text := string(literal)
+		f.parts = append(f.parts, func(buf []byte, _ *Entry) []byte {
+			return append(buf, text...)
+		})
+		literal = literal[:0]
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			literal = append(literal, c)
+			continue
+		}
+
+		i++
+		if i >= len(format) {
+			return nil, fmt.Errorf("accesslog: format ends with %%")
+		}
+
+		// %{argument}directive
+		arg := ""
+		if format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("accesslog: unclosed %%{ in format")
+			}
+			arg = format[i+1 : i+end]
+			i += end + 1
+			if i >= len(format) {
+				return nil, fmt.Errorf("accesslog: missing directive after %%{%s}", arg)
+			}
+		}
+
+		// %>s is the final status, which is the only status we know
+		if format[i] == '>' {
+			i++
+			if i >= len(format) {
+				return nil, fmt.Errorf("accesslog: format ends with %%>")
+			}
+		}
+
+		if format[i] == '%' {
+			literal = append(literal, '%')
+			continue
+		}
+
+		p, err := directive(format[i], arg)
+		if err != nil {
+			return nil, err
+		}
+		flush()
+		f.parts = append(f.parts, p)
+	}
+	flush()
+
+	return f, nil
+}
+
+// Append formats e and appends the result to buf
+func (f *Format) Append(buf []byte, e *Entry) []byte {
+	for _, p := range f.parts {
+		buf = p(buf, e)
+	}
+	return buf
+}
+
+// String formats e
+func (f *Format) String(e *Entry) string {
+	return string(f.Append(nil, e))
+}
+
+func directive(c byte, arg string) (part, error) {
+	switch c {
+	case 'h', 'a':
+		return func(buf []byte, e *Entry) []byte {
+			return appendValue(buf, remoteHost(e.Request))
+		}, nil
+	case 'l':
+		return func(buf []byte, _ *Entry) []byte {
+			return append(buf, '-')
+		}, nil
+	case 'u':
+		return func(buf []byte, e *Entry) []byte {
+			return appendValue(buf, user(e.Request))
+		}, nil
+	case 't':
+		return func(buf []byte, e *Entry) []byte {
+			buf = append(buf, '[')
+			buf = e.Start.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+			return append(buf, ']')
+		}, nil
+	case 'r':
+		return func(buf []byte, e *Entry) []byte {
+			return appendEscaped(buf, e.Request.Method+" "+e.Request.URL.RequestURI()+" "+e.Request.Proto)
+		}, nil
+	case 'm':
+		return func(buf []byte, e *Entry) []byte {
+			return appendEscaped(buf, e.Request.Method)
+		}, nil
+	case 'U':
+		return func(buf []byte, e *Entry) []byte {
+			return appendEscaped(buf, e.Request.URL.Path)
+		}, nil
+	case 'q':
+		return func(buf []byte, e *Entry) []byte {
+			if e.Request.URL.RawQuery == "" {
+				return buf
+			}
+			return appendEscaped(append(buf, '?'), e.Request.URL.RawQuery)
+		}, nil
+	case 'H':
+		return func(buf []byte, e *Entry) []byte {
+			return appendEscaped(buf, e.Request.Proto)
+		}, nil
+	case 's':
+		return func(buf []byte, e *Entry) []byte {
+			return strconv.AppendInt(buf, int64(e.Status), 10)
+		}, nil
+	case 'b':
+		return func(buf []byte, e *Entry) []byte {
+			if e.Size == 0 {
+				return append(buf, '-')
+			}
+			return strconv.AppendInt(buf, int64(e.Size), 10)
+		}, nil
+	case 'B':
+		return func(buf []byte, e *Entry) []byte {
+			return strconv.AppendInt(buf, int64(e.Size), 10)
+		}, nil
+	case 'D':
+		return func(buf []byte, e *Entry) []byte {
+			return strconv.AppendInt(buf, e.Duration.Microseconds(), 10)
+		}, nil
+	case 'T':
+		return func(buf []byte, e *Entry) []byte {
+			return strconv.AppendInt(buf, int64(e.Duration/time.Second), 10)
+		}, nil
+	case 'i':
+		if arg == "" {
+			return nil, fmt.Errorf("accesslog: %%i needs a header name")
+		}
+		return func(buf []byte, e *Entry) []byte {
+			return appendValue(buf, e.Request.Header.Get(arg))
+		}, nil
+	case 'o':
+		if arg == "" {
+			return nil, fmt.Errorf("accesslog: %%o needs a header name")
+		}
+		return func(buf []byte, e *Entry) []byte {
+			return appendValue(buf, e.Header.Get(arg))
+		}, nil
+	case 'x':
+		if arg != "trace_id" {
+			return nil, fmt.Errorf("accesslog: unknown %%{%s}x", arg)
+		}
+		return func(buf []byte, e *Entry) []byte {
+			if id, ok := e.Request.Context().Value(middleware.TraceIDKey).(string); ok {
+				return appendValue(buf, id)
+			}
+			return append(buf, '-')
+		}, nil
+	}
+
+	return nil, fmt.Errorf("accesslog: unknown directive %%%c", c)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func user(r *http.Request) string {
+	if name, _, ok := r.BasicAuth(); ok {
+		return name
+	}
+	if id, ok := r.Context().Value(middleware.UserIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// appendValue writes "-" for empty values like Apache does
+func appendValue(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	return appendEscaped(buf, s)
+}
+
+// appendEscaped escapes quotes, backslashes and control characters so a
+// client can't forge log lines
+func appendEscaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c == 0x7f:
+			buf = append(buf, `\x`...)
+			buf = append(buf, hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+const hexDigits = "0123456789abcdef"
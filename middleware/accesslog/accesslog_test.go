@@ -0,0 +1,110 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func testEntry() *Entry {
+	r := httptest.NewRequest(http.MethodGet, "/users?id=7", nil)
+	r.RemoteAddr = "192.0.2.1:51234"
+	r.Header.Set("User-Agent", `curl "8"`)
+	r.SetBasicAuth("alice", "secret")
+	r = r.WithContext(context.WithValue(r.Context(), middleware.TraceIDKey, "abc123"))
+
+	return &Entry{
+		Request:  r,
+		Header:   http.Header{"Content-Type": {"application/json"}},
+		Status:   200,
+		Size:     512,
+		Start:    time.Date(2026, 1, 2, 15, 4, 5, 0, time.FixedZone("", 3600)),
+		Duration: 1500 * time.Millisecond,
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%h %a", "192.0.2.1 192.0.2.1"},
+		{"%l %u", "- alice"},
+		{"%t", "[02/Jan/2026:15:04:05 +0100]"},
+		{`"%r"`, `"GET /users?id=7 HTTP/1.1"`},
+		{"%m %U%q %H", "GET /users?id=7 HTTP/1.1"},
+		{"%s %>s", "200 200"},
+		{"%b %B", "512 512"},
+		{"%D %T", "1500000 1"},
+		{`"%{User-Agent}i" %{Referer}i`, `"curl \"8\"" -`},
+		{"%{Content-Type}o", "application/json"},
+		{"%{trace_id}x", "abc123"},
+		{"100%%", "100%"},
+		{CommonFormat, `192.0.2.1 - alice [02/Jan/2026:15:04:05 +0100] "GET /users?id=7 HTTP/1.1" 200 512`},
+	}
+
+	e := testEntry()
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := Parse(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.String(e); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, format := range []string{
+		"%",
+		"%>",
+		"%{User-Agent",
+		"%{User-Agent}",
+		"%i",
+		"%o",
+		"%{span_id}x",
+		"%z",
+	} {
+		if _, err := Parse(format); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", format)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	e := testEntry()
+	e.Request.Header.Set("User-Agent", "evil\n127.0.0.1 - - \\")
+	e.Size = 0
+
+	f, _ := Parse("%{User-Agent}i %b")
+	if got, want := f.String(e), `evil\x0a127.0.0.1 - - \\ -`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	mw := middleware.New(nil)
+	h := New(mw, &Config{Format: "%m %U %>s %b", Output: &out})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", nil))
+
+	if got := out.String(); got != "POST /items 201 5\n" {
+		t.Errorf("line = %q", got)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Error("want exactly one line per request")
+	}
+}
@@ -0,0 +1,341 @@
+// Package audit provides audit logging middleware that records who changed what
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Redacted replaces sensitive values in records
+const Redacted = "[REDACTED]"
+
+// Config holds audit middleware configuration
+type Config struct {
+	// Methods to audit, e.g. POST, PUT, PATCH, DELETE
+	Methods []string
+	// Paths to audit including everything below them, matched on whole
+	// segments (if empty, audits all paths)
+	Routes []string
+	// Maximum bytes captured per request and response body
+	MaxBodySize int
+	// Dotted JSON paths to redact in bodies, "*" matches any key or index.
+	// A single key like "password" matches at any depth. Keys are compared
+	// case-insensitively.
+	// Example: "password", "user.token", "items.*.secret"
+	RedactJSONPaths []string
+	// Headers to redact (case-insensitive)
+	RedactHeaders []string
+	// Query parameters to redact (case-insensitive)
+	RedactQuery []string
+	// Destination of audit records
+	Sink Sink
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Methods: []string{
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		MaxBodySize:     64 << 10, // 64KB
+		RedactJSONPaths: []string{"password", "token", "secret"},
+		RedactHeaders: []string{
+			"Authorization",
+			"Cookie",
+			"Set-Cookie",
+			"X-Api-Key",
+			"X-CSRF-Token",
+		},
+		RedactQuery: []string{"token", "password", "api_key"},
+		Sink:        NewSlogSink(slog.Default()),
+	}
+}
+
+// Record is a single audit entry
+type Record struct {
+	Time            time.Time         `json:"time"`
+	TraceID         string            `json:"trace_id"`
+	UserID          string            `json:"user_id,omitempty"`
+	RemoteAddr      string            `json:"remote_addr"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Route           string            `json:"route,omitempty"`
+	Query           string            `json:"query,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     any               `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseBody    any               `json:"response_body,omitempty"`
+	Duration        time.Duration     `json:"duration"`
+	BodiesTruncated bool              `json:"bodies_truncated,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(ctx context.Context, rec *Record) error
+}
+
+// New creates audit middleware with custom config.
+// Place it after the authentication middleware so UserIDKey is set.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Sink == nil {
+		config.Sink = NewSlogSink(slog.Default())
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultConfig().MaxBodySize
+	}
+
+	paths := make([][]string, 0, len(config.RedactJSONPaths))
+	for _, p := range config.RedactJSONPaths {
+		paths = append(paths, strings.Split(p, "."))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) || !shouldAudit(r, config) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+
+			// Capture bodies while the handler streams them
+			reqBody := &captureReader{ReadCloser: r.Body, limit: config.MaxBodySize}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = reqBody
+			}
+			wrapped := middleware.NewCaptureWriter(w, config.MaxBodySize)
+
+			next.ServeHTTP(wrapped, r)
+
+			rec := &Record{
+				Time:           start,
+				TraceID:        middleware.GetTraceIDFromContext(r.Context()),
+				RemoteAddr:     r.RemoteAddr,
+				Method:         r.Method,
+				Path:           r.URL.Path,
+				Route:          r.Pattern,
+				Query:          redactQuery(r.URL.Query(), config.RedactQuery),
+				RequestHeaders: redactHeaders(r.Header, config.RedactHeaders),
+				Status:         wrapped.StatusCode(),
+				Duration:       time.Since(start),
+			}
+			if id, ok := r.Context().Value(middleware.UserIDKey).(string); ok {
+				rec.UserID = id
+			}
+
+			rec.RequestBody = redactBody(reqBody.buf.Bytes(), reqBody.truncated, r.Header.Get("Content-Type"), paths)
+			rec.ResponseBody = redactBody(wrapped.Body(), wrapped.Truncated(), w.Header().Get("Content-Type"), paths)
+			rec.BodiesTruncated = reqBody.truncated || wrapped.Truncated()
+
+			// The request context may be canceled once the client is gone,
+			// the audit record must be written regardless
+			if err := config.Sink.Write(context.WithoutCancel(r.Context()), rec); err != nil {
+				mw.Logger().Error("audit sink failed",
+					slog.String("trace_id", rec.TraceID),
+					slog.String("error", err.Error()),
+				)
+			}
+		})
+	}
+}
+
+// Handler creates audit middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+func shouldAudit(r *http.Request, config *Config) bool {
+	if len(config.Methods) > 0 && !slices.Contains(config.Methods, r.Method) {
+		return false
+	}
+	if len(config.Routes) == 0 {
+		return true
+	}
+	for _, route := range config.Routes {
+		if middleware.MatchPath(r.URL.Path, route) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(header http.Header, redact []string) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(header))
+	for key, values := range header {
+		value := strings.Join(values, ", ")
+		for _, name := range redact {
+			if strings.EqualFold(key, name) {
+				value = Redacted
+				break
+			}
+		}
+		out[key] = value
+	}
+	return out
+}
+
+func redactQuery(query url.Values, redact []string) string {
+	if len(query) == 0 {
+		return ""
+	}
+
+	for key, values := range query {
+		for _, name := range redact {
+			if strings.EqualFold(key, name) {
+				for i := range values {
+					values[i] = Redacted
+				}
+				break
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// redactBody returns JSON bodies as json.RawMessage with paths redacted and
+// form bodies with matching fields redacted. Bodies that may hide a secret
+// we can't find, e.g. truncated JSON or multipart forms, are replaced
+// entirely unless there is nothing to redact.
+func redactBody(body []byte, truncated bool, contentType string, paths [][]string) any {
+	if len(body) == 0 {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if truncated && len(paths) > 0 {
+			return Redacted
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return Redacted
+		}
+		fields := make([]string, 0, len(paths))
+		for _, path := range paths {
+			fields = append(fields, path[len(path)-1])
+		}
+		return redactQuery(form, fields)
+
+	case strings.Contains(contentType, "json") || json.Valid(body):
+		if truncated && len(paths) > 0 {
+			return Redacted
+		}
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return Redacted
+		}
+		for _, path := range paths {
+			redactPath(doc, path)
+		}
+		redacted, err := json.Marshal(doc)
+		if err != nil {
+			return Redacted
+		}
+		return json.RawMessage(redacted)
+	}
+
+	if len(paths) > 0 {
+		return Redacted
+	}
+	return string(body)
+}
+
+func redactPath(node any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	if len(path) == 1 && path[0] != "*" {
+		redactKey(node, path[0])
+		return
+	}
+
+	key, rest := path[0], path[1:]
+
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if key != "*" && !strings.EqualFold(k, key) {
+				continue
+			}
+			if len(rest) == 0 {
+				v[k] = Redacted
+				continue
+			}
+			redactPath(child, rest)
+		}
+	case []any:
+		// Arrays are transparent for named keys so "items.secret"
+		// matches every element of items
+		for i, child := range v {
+			if key == "*" {
+				if len(rest) == 0 {
+					v[i] = Redacted
+					continue
+				}
+				redactPath(child, rest)
+				continue
+			}
+			redactPath(child, path)
+		}
+	}
+}
+
+// redactKey redacts key at any depth
+func redactKey(node any, key string) {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if strings.EqualFold(k, key) {
+				v[k] = Redacted
+				continue
+			}
+			redactKey(child, key)
+		}
+	case []any:
+		for _, child := range v {
+			redactKey(child, key)
+		}
+	}
+}
+
+// captureReader copies up to limit bytes of what the handler reads
+type captureReader struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (cr *captureReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.capture(p[:n])
+	return n, err
+}
+
+func (cr *captureReader) capture(data []byte) {
+	if remaining := cr.limit - cr.buf.Len(); remaining < len(data) {
+		cr.truncated = true
+		data = data[:max(remaining, 0)]
+	}
+	cr.buf.Write(data)
+}
@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// recordSink keeps the last record written
+type recordSink struct {
+	rec *Record
+}
+
+func (s *recordSink) Write(_ context.Context, rec *Record) error {
+	s.rec = rec
+	return nil
+}
+
+func TestRedactBody(t *testing.T) {
+	paths := [][]string{{"password"}, {"user", "token"}, {"items", "*", "secret"}}
+	defaults := [][]string{{"password"}, {"token"}, {"secret"}}
+
+	tests := []struct {
+		name        string
+		body        string
+		truncated   bool
+		contentType string
+		paths       [][]string
+		want        string
+	}{
+		{
+			name:        "top level",
+			body:        `{"name":"alice","password":"hunter2"}`,
+			contentType: "application/json",
+			paths:       paths,
+			want:        `{"name":"alice","password":"[REDACTED]"}`,
+		},
+		{
+			name:        "nested",
+			body:        `{"user":{"id":7,"token":"abc"}}`,
+			contentType: "application/json",
+			paths:       paths,
+			want:        `{"user":{"id":7,"token":"[REDACTED]"}}`,
+		},
+		{
+			name:        "wildcard",
+			body:        `{"items":[{"secret":"a","id":1},{"secret":"b","id":2}]}`,
+			contentType: "application/json",
+			paths:       paths,
+			want:        `{"items":[{"id":1,"secret":"[REDACTED]"},{"id":2,"secret":"[REDACTED]"}]}`,
+		},
+		{
+			name:        "single key at any depth",
+			body:        `{"user":{"password":"x","profile":[{"secret":"y"}]}}`,
+			contentType: "application/json",
+			paths:       defaults,
+			want:        `{"user":{"password":"[REDACTED]","profile":[{"secret":"[REDACTED]"}]}}`,
+		},
+		{
+			name:        "mixed case",
+			body:        `{"Password":"x","User":{"TOKEN":"y"}}`,
+			contentType: "application/json",
+			paths:       paths,
+			want:        `{"Password":"[REDACTED]","User":{"TOKEN":"[REDACTED]"}}`,
+		},
+		{
+			name:        "mixed case form",
+			body:        "name=alice&PassWord=hunter2",
+			contentType: "application/x-www-form-urlencoded",
+			paths:       paths,
+			want:        "PassWord=%5BREDACTED%5D&name=alice",
+		},
+		{
+			name:        "form fields",
+			body:        "name=alice&password=hunter2",
+			contentType: "application/x-www-form-urlencoded",
+			paths:       paths,
+			want:        "name=alice&password=%5BREDACTED%5D",
+		},
+		{
+			name:        "truncated json",
+			body:        `{"name":"alice","pass`,
+			truncated:   true,
+			contentType: "application/json",
+			paths:       paths,
+			want:        Redacted,
+		},
+		{
+			name:        "truncated form",
+			body:        "name=alice&pass",
+			truncated:   true,
+			contentType: "application/x-www-form-urlencoded",
+			paths:       paths,
+			want:        Redacted,
+		},
+		{
+			name:        "multipart",
+			body:        "--x\r\nContent-Disposition: form-data; name=\"password\"\r\n\r\nhunter2\r\n--x--",
+			contentType: "multipart/form-data; boundary=x",
+			paths:       paths,
+			want:        Redacted,
+		},
+		{
+			name:        "plain text without paths",
+			body:        "hello",
+			contentType: "text/plain",
+			want:        "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactBody([]byte(tt.body), tt.truncated, tt.contentType, tt.paths)
+
+			var s string
+			switch v := got.(type) {
+			case json.RawMessage:
+				s = string(v)
+			case string:
+				s = v
+			}
+			if s != tt.want {
+				t.Errorf("redactBody() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := &recordSink{}
+	config := DefaultConfig()
+	config.Sink = sink
+	config.MaxBodySize = 0 // defaulted
+
+	h := New(middleware.New(nil), config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":7,"token":"t0k3n"}`))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/users?Token=abc&page=2", strings.NewReader(`{"name":"alice","password":"hunter2"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer abc")
+	ctx := context.WithValue(r.Context(), middleware.TraceIDKey, "trace-1")
+	ctx = context.WithValue(ctx, middleware.UserIDKey, "user-42")
+	h.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+
+	rec := sink.rec
+	if rec == nil {
+		t.Fatal("no record written")
+	}
+	if rec.TraceID != "trace-1" || rec.UserID != "user-42" {
+		t.Errorf("trace_id = %q, user_id = %q", rec.TraceID, rec.UserID)
+	}
+	if rec.Status != http.StatusCreated {
+		t.Errorf("status = %d, want 201", rec.Status)
+	}
+	if rec.Query != "Token=%5BREDACTED%5D&page=2" {
+		t.Errorf("query = %q", rec.Query)
+	}
+	if rec.RequestHeaders["Authorization"] != Redacted || rec.RequestHeaders["Content-Type"] != "application/json" {
+		t.Errorf("headers = %v", rec.RequestHeaders)
+	}
+	if got := string(rec.RequestBody.(json.RawMessage)); got != `{"name":"alice","password":"[REDACTED]"}` {
+		t.Errorf("request body = %s", got)
+	}
+	if got := string(rec.ResponseBody.(json.RawMessage)); got != `{"id":7,"token":"[REDACTED]"}` {
+		t.Errorf("response body = %s", got)
+	}
+	if rec.BodiesTruncated {
+		t.Error("bodies truncated with the default MaxBodySize")
+	}
+}
+
+func TestMiddlewareTruncated(t *testing.T) {
+	sink := &recordSink{}
+	config := DefaultConfig()
+	config.Sink = sink
+	config.MaxBodySize = 8
+
+	h := New(middleware.New(nil), config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"password":"hunter2"}`))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !sink.rec.BodiesTruncated {
+		t.Error("BodiesTruncated not set")
+	}
+	if sink.rec.RequestBody != Redacted {
+		t.Errorf("request body = %v, want %s", sink.rec.RequestBody, Redacted)
+	}
+}
+
+func TestShouldAudit(t *testing.T) {
+	config := &Config{Methods: []string{http.MethodPost}, Routes: []string{"/admin"}}
+
+	tests := []struct {
+		method, path string
+		want         bool
+	}{
+		{http.MethodPost, "/admin/users", true},
+		{http.MethodGet, "/admin/users", false},
+		{http.MethodPost, "/public", false},
+		{http.MethodPost, "/administrator", false},
+		{http.MethodPost, "/admin", true},
+	}
+
+	for _, tt := range tests {
+		if got := shouldAudit(httptest.NewRequest(tt.method, tt.path, nil), config); got != tt.want {
+			t.Errorf("%s %s: shouldAudit = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// SlogSink writes audit records as structured log entries
+type SlogSink struct {
+	logger *slog.Logger
+}
+
+// NewSlogSink creates a sink that logs records at info level
+func NewSlogSink(logger *slog.Logger) *SlogSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogSink{logger: logger}
+}
+
+// Write logs rec
+func (s *SlogSink) Write(ctx context.Context, rec *Record) error {
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "audit",
+		slog.Time("time", rec.Time),
+		slog.String("trace_id", rec.TraceID),
+		slog.String("user_id", rec.UserID),
+		slog.String("remote_addr", rec.RemoteAddr),
+		slog.String("method", rec.Method),
+		slog.String("path", rec.Path),
+		slog.String("route", rec.Route),
+		slog.String("query", rec.Query),
+		slog.Any("request_headers", rec.RequestHeaders),
+		slog.Any("request_body", rec.RequestBody),
+		slog.Int("status", rec.Status),
+		slog.Any("response_body", rec.ResponseBody),
+		slog.Duration("duration", rec.Duration),
+		slog.Bool("bodies_truncated", rec.BodiesTruncated),
+	)
+	return nil
+}
+
+// JSONLinesSink writes one JSON object per line.
+// Use a *rotate.Writer as w for rotated audit files.
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesSink creates a sink writing to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// Write encodes rec as a single line
+func (s *JSONLinesSink) Write(_ context.Context, rec *Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(line)
+	return err
+}
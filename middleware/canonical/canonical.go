@@ -0,0 +1,167 @@
+// Package canonical provides canonical host and HTTPS redirect middleware
+//
+// Requests for an unknown Host are rejected with 421 Misdirected Request so
+// forged Host headers never reach handlers that build absolute URLs.
+package canonical
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/realip"
+)
+
+// Config holds canonical host configuration
+type Config struct {
+	// Canonical host including the port if not default, e.g. "example.com".
+	// Requests for other allowed hosts are redirected to it. Empty keeps the host.
+	Host string
+	// Hosts that may be requested, "*.example.com" matches any subdomain.
+	// Host is always allowed. If both are empty every host is allowed.
+	AllowedHosts []string
+	// Redirect plain HTTP requests to HTTPS
+	HTTPS bool
+	// CIDRs of proxies whose X-Forwarded-Proto header is trusted
+	TrustedProxies []string
+	// Status code of redirects, 308 keeps method and body
+	RedirectCode int
+}
+
+// DefaultConfig redirects to HTTPS behind proxies on private networks
+func DefaultConfig() *Config {
+	return &Config{
+		HTTPS:          true,
+		TrustedProxies: realip.DefaultConfig().TrustedProxies,
+		RedirectCode:   http.StatusPermanentRedirect,
+	}
+}
+
+// New creates canonical host middleware with custom config.
+// It panics if a trusted proxy CIDR is invalid.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.RedirectCode == 0 {
+		config.RedirectCode = http.StatusPermanentRedirect
+	}
+
+	proxies, err := realip.NewResolver(&realip.Config{TrustedProxies: config.TrustedProxies})
+	if err != nil {
+		panic(err)
+	}
+
+	canonicalName := hostname(config.Host)
+
+	allowed := make([]string, 0, len(config.AllowedHosts)+1)
+	for _, host := range config.AllowedHosts {
+		allowed = append(allowed, hostname(host))
+	}
+	if canonicalName != "" {
+		allowed = append(allowed, canonicalName)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			name := hostname(r.Host)
+			if len(allowed) > 0 && !isHostAllowed(name, allowed) {
+				misdirected(mw, w, r)
+				return
+			}
+
+			secure := r.TLS != nil
+			if !secure && proxies.Trusted(realip.RemoteAddr(r)) {
+				secure = forwardedProto(r) == "https"
+			}
+
+			target := r.Host
+			if canonicalName != "" && name != canonicalName {
+				target = config.Host
+			}
+
+			upgrade := config.HTTPS && !secure
+			if !upgrade && target == r.Host {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme := "http"
+			if secure || upgrade {
+				scheme = "https"
+			}
+			if upgrade && target == r.Host {
+				// The port of the plain HTTP listener is wrong for HTTPS
+				target = name
+				if strings.Contains(target, ":") {
+					target = "[" + target + "]"
+				}
+			}
+
+			http.Redirect(w, r, scheme+"://"+target+r.URL.RequestURI(), config.RedirectCode)
+		})
+	}
+}
+
+// Handler creates HTTPS redirect middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+func misdirected(mw *middleware.Middleware, w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	mw.Logger().Warn("unknown host rejected",
+		slog.String("trace_id", traceID),
+		slog.String("host", r.Host),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMisdirectedRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    "misdirected request",
+		"trace_id": traceID,
+	})
+}
+
+// forwardedProto returns the protocol the first proxy received
+func forwardedProto(r *http.Request) string {
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if i := strings.IndexByte(proto, ','); i >= 0 {
+		proto = proto[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(proto))
+}
+
+// hostname lowercases host and strips the port and a trailing dot
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func isHostAllowed(name string, allowed []string) bool {
+	if name == "" {
+		return false
+	}
+	for _, host := range allowed {
+		if host == name {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(host, "*"); ok && strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package canonical
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestCanonical(t *testing.T) {
+	config := DefaultConfig()
+	config.Host = "example.com"
+	config.AllowedHosts = []string{"www.example.com", "*.example.org"}
+
+	h := New(middleware.New(nil), config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name         string
+		url          string
+		host         string
+		remoteAddr   string
+		proto        string
+		tls          bool
+		wantStatus   int
+		wantLocation string
+	}{
+		{"canonical https", "/a?b=1", "example.com", "203.0.113.1:1234", "", true, http.StatusOK, ""},
+		{"upgrade", "/a?b=1", "example.com:80", "203.0.113.1:1234", "", false, http.StatusPermanentRedirect, "https://example.com/a?b=1"},
+		{"www to apex", "/a", "WWW.example.com", "203.0.113.1:1234", "", true, http.StatusPermanentRedirect, "https://example.com/a"},
+		{"wildcard", "/", "api.example.org", "10.0.0.1:1234", "https", false, http.StatusPermanentRedirect, "https://example.com/"},
+		{"trusted proxy https", "/", "example.com", "10.0.0.1:1234", "https", false, http.StatusOK, ""},
+		{"untrusted proxy header", "/", "example.com", "203.0.113.1:1234", "https", false, http.StatusPermanentRedirect, "https://example.com/"},
+		{"unknown host", "/", "evil.com", "203.0.113.1:1234", "", true, http.StatusMisdirectedRequest, ""},
+		{"wildcard apex", "/", "example.org", "203.0.113.1:1234", "", true, http.StatusMisdirectedRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.Host = tt.host
+			r.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			} else {
+				r.TLS = nil
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Expected Location %q, got %q", tt.wantLocation, got)
+			}
+		})
+	}
+}
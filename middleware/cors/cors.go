@@ -51,6 +51,14 @@ func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
 		config = DefaultConfig()
 	}
 
+	// Header values don't change per request
+	var (
+		allowedMethods = strings.Join(config.AllowedMethods, ", ")
+		allowedHeaders = strings.Join(config.AllowedHeaders, ", ")
+		exposedHeaders = strings.Join(config.ExposedHeaders, ", ")
+		maxAge         = strconv.Itoa(config.MaxAge)
+	)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip if excluded
@@ -70,17 +78,17 @@ func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
 				}
 
 				if len(config.ExposedHeaders) > 0 {
-					w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+					w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
 				}
 			}
 
 			// Handle preflight requests
 			if r.Method == http.MethodOptions {
-				w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
-				w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+				w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
 
 				if config.MaxAge > 0 {
-					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+					w.Header().Set("Access-Control-Max-Age", maxAge)
 				}
 
 				if !config.OptionsPassthrough {
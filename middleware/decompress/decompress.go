@@ -0,0 +1,227 @@
+// Package decompress provides request body decompression middleware
+//
+// Bodies sent with Content-Encoding gzip or deflate are decompressed
+// transparently. The decompressed size and the compression ratio are limited
+// to protect against decompression bombs.
+package decompress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/responder"
+)
+
+// ErrRatio is returned by the body when the compression ratio exceeds
+// MaxRatio, wrapped in a *responder.TooLargeError. Corrupt streams fail with
+// a *responder.BadRequestError, so JSONResponder.HandleError answers both
+// with a client error.
+var ErrRatio = errors.New("compression ratio too high")
+
+// Config holds decompression configuration
+type Config struct {
+	// Maximum decompressed body size in bytes
+	MaxSize int64
+	// Maximum ratio of decompressed to compressed bytes, 0 disables the check
+	MaxRatio float64
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		MaxSize:  10 << 20, // 10MB
+		MaxRatio: 100,
+	}
+}
+
+// ratioGrace is decompressed without a ratio check, tiny bodies of
+// repeated characters compress very well without being an attack
+const ratioGrace = 64 << 10
+
+var gzipPool sync.Pool
+
+// New creates decompression middleware with custom config
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if mw.ShouldSkip(r) || encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			compressed := &countingReader{r: r.Body}
+
+			var (
+				decoder io.ReadCloser
+				err     error
+			)
+			switch encoding {
+			case "gzip", "x-gzip":
+				decoder, err = newGzipReader(compressed)
+			case "deflate":
+				decoder, err = zlib.NewReader(compressed)
+			default:
+				// RFC 7694: tell the client which encodings are accepted
+				w.Header().Set("Accept-Encoding", "gzip, deflate")
+				reject(mw, w, r, http.StatusUnsupportedMediaType, "unsupported content encoding", encoding)
+				return
+			}
+			if err != nil {
+				reject(mw, w, r, http.StatusBadRequest, "malformed compressed body", encoding)
+				return
+			}
+
+			body := &body{
+				decoder:    decoder,
+				original:   r.Body,
+				compressed: compressed,
+				config:     config,
+			}
+			defer body.release()
+
+			// The body no longer matches the headers sent by the client.
+			// Limits like http.MaxBytesReader now apply to decompressed bytes.
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Length")
+			r.Header.Del("Content-Encoding")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Handler creates decompression middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+func reject(mw *middleware.Middleware, w http.ResponseWriter, r *http.Request, status int, message, encoding string) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	mw.Logger().Warn("request body rejected",
+		slog.String("trace_id", traceID),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("content_encoding", encoding),
+		slog.Int("status", status),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    message,
+		"trace_id": traceID,
+	})
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	if gz, ok := gzipPool.Get().(*gzip.Reader); ok {
+		if err := gz.Reset(r); err != nil {
+			return nil, err
+		}
+		return gz, nil
+	}
+	return gzip.NewReader(r)
+}
+
+// countingReader counts the compressed bytes read from the client
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// body decompresses and enforces the size and ratio limits
+type body struct {
+	decoder    io.ReadCloser
+	original   io.ReadCloser
+	compressed *countingReader
+	config     *Config
+	n          int64
+	err        error
+	released   bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.released {
+		return 0, errors.New("decompress: read after handler returned")
+	}
+
+	// Read at most one byte past the limit to detect oversized bodies
+	if remaining := b.config.MaxSize - b.n + 1; b.config.MaxSize > 0 && int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := b.decoder.Read(p)
+	b.n += int64(n)
+
+	if b.config.MaxSize > 0 && b.n > b.config.MaxSize {
+		b.err = &http.MaxBytesError{Limit: b.config.MaxSize}
+		return n - int(b.n-b.config.MaxSize), b.err
+	}
+
+	if b.config.MaxRatio > 0 && b.n > ratioGrace && b.compressed.n > 0 &&
+		float64(b.n)/float64(b.compressed.n) > b.config.MaxRatio {
+		b.err = &responder.TooLargeError{Err: fmt.Errorf("%w: more than %.0f:1", ErrRatio, b.config.MaxRatio)}
+		return n, b.err
+	}
+
+	if err != nil && err != io.EOF {
+		if corrupt(err) {
+			err = &responder.BadRequestError{Err: fmt.Errorf("malformed compressed body: %w", err)}
+		}
+		b.err = err
+	}
+	return n, err
+}
+
+// corrupt reports whether err comes from an invalid or truncated stream
+// rather than from reading the connection
+func corrupt(err error) bool {
+	var corruptInput flate.CorruptInputError
+	return errors.As(err, &corruptInput) ||
+		errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) ||
+		errors.Is(err, zlib.ErrChecksum) || errors.Is(err, zlib.ErrHeader) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (b *body) Close() error {
+	return b.original.Close()
+}
+
+// release returns the gzip reader to the pool once the handler is done
+func (b *body) release() {
+	if b.released {
+		return
+	}
+	b.released = true
+	if gz, ok := b.decoder.(*gzip.Reader); ok {
+		gzipPool.Put(gz)
+		return
+	}
+	b.decoder.Close()
+}
@@ -0,0 +1,146 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	rjson "github.com/bit8bytes/toolbox/responder/json"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	payload := []byte(`{"name":"toolbox"}`)
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		config     *Config
+		wantStatus int
+		wantBody   string
+		wantErr    error
+	}{
+		{"gzip", "gzip", compress(t, "gzip", payload), nil, http.StatusOK, string(payload), nil},
+		{"deflate", "deflate", compress(t, "deflate", payload), nil, http.StatusOK, string(payload), nil},
+		{"identity", "", payload, nil, http.StatusOK, string(payload), nil},
+		{"unsupported", "br", payload, nil, http.StatusUnsupportedMediaType, "", nil},
+		{"malformed", "gzip", payload, nil, http.StatusBadRequest, "", nil},
+		{"too large", "gzip", compress(t, "gzip", payload), &Config{MaxSize: 10}, http.StatusOK, string(payload[:10]), &http.MaxBytesError{}},
+		{"bomb", "gzip", compress(t, "gzip", make([]byte, 1<<20)), &Config{MaxSize: 10 << 20, MaxRatio: 100}, http.StatusOK, "", ErrRatio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got     []byte
+				readErr error
+			)
+			h := New(middleware.New(nil), tt.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Encoding") != "" || r.ContentLength != -1 && tt.encoding != "" {
+					t.Error("Expected encoding headers to be removed")
+				}
+				got, readErr = io.ReadAll(r.Body)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case tt.wantErr == nil && readErr != nil:
+				t.Errorf("Unexpected error %v", readErr)
+			case errors.As(tt.wantErr, &maxBytesErr) && !errors.As(readErr, &maxBytesErr):
+				t.Errorf("Expected MaxBytesError, got %v", readErr)
+			case errors.Is(tt.wantErr, ErrRatio) && !errors.Is(readErr, ErrRatio):
+				t.Errorf("Expected ErrRatio, got %v", readErr)
+			}
+			if tt.wantBody != "" && !strings.HasPrefix(string(got), tt.wantBody) {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestErrorsThroughReadJSON(t *testing.T) {
+	payload := []byte(`{"name":"toolbox"}`)
+	valid := compress(t, "gzip", payload)
+
+	// Flip a byte of the deflate data behind the 10 byte gzip header
+	corrupted := bytes.Clone(valid)
+	corrupted[12] ^= 0xff
+
+	tests := []struct {
+		name   string
+		body   []byte
+		config *Config
+		want   int
+	}{
+		{"valid", valid, nil, http.StatusNoContent},
+		{"corrupt", corrupted, nil, http.StatusBadRequest},
+		{"truncated", valid[:len(valid)-4], nil, http.StatusBadRequest},
+		{"too large", valid, &Config{MaxSize: 10}, http.StatusRequestEntityTooLarge},
+		{"bomb", compress(t, "gzip", bytes.Repeat([]byte(" "), 1<<20)), &Config{MaxSize: 10 << 20, MaxRatio: 100}, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			jr := rjson.New(slog.New(slog.NewJSONHandler(&logs, nil)), rjson.WithMaxBytes(20<<20))
+			h := New(middleware.New(nil), tt.config)(jr.Handle(func(w http.ResponseWriter, r *http.Request) error {
+				var input struct{ Name string }
+				if err := jr.ReadJSON(w, r, &input); err != nil {
+					return err
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return nil
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if logs.Len() != 0 {
+				t.Errorf("Expected no unexpected error log, got %s", logs.String())
+			}
+		})
+	}
+}
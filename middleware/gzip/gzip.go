@@ -5,7 +5,9 @@ import (
 	"compress/gzip"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/bit8bytes/toolbox/middleware"
 )
@@ -15,6 +17,8 @@ type Config struct {
 	// Compression level (1-9, where 9 is best compression)
 	Level int
 	// Minimum response size to compress (bytes)
+	// Checked against Content-Length or, if unset, the body is held back
+	// until MinSize bytes were written
 	MinSize int
 	// Content types to compress (if empty, compresses all)
 	Types []string
@@ -43,6 +47,20 @@ func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
 	if config == nil {
 		config = DefaultConfig()
 	}
+	if _, err := gzip.NewWriterLevel(io.Discard, config.Level); err != nil {
+		config.Level = gzip.DefaultCompression
+	}
+
+	// gzip writers are expensive to create, so they are reused
+	gzipPool := &sync.Pool{
+		New: func() any {
+			gz, _ := gzip.NewWriterLevel(io.Discard, config.Level)
+			return gz
+		},
+	}
+	writerPool := &sync.Pool{
+		New: func() any { return new(gzipResponseWriter) },
+	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -52,24 +70,17 @@ func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
 				return
 			}
 
-			// Create gzip writer
-			gz, err := gzip.NewWriterLevel(w, config.Level)
-			if err != nil {
-				next.ServeHTTP(w, r)
-				return
-			}
-			defer gz.Close()
-
-			// Set headers
-			w.Header().Set("Content-Encoding", "gzip")
 			w.Header().Add("Vary", "Accept-Encoding")
 
 			// Wrap response writer
-			wrapped := &gzipResponseWriter{
-				ResponseWriter: w,
-				Writer:         gz,
-				config:         config,
-			}
+			wrapped := writerPool.Get().(*gzipResponseWriter)
+			wrapped.ResponseWriter = w
+			wrapped.config = config
+			wrapped.pool = gzipPool
+			defer func() {
+				wrapped.close()
+				writerPool.Put(wrapped)
+			}()
 
 			next.ServeHTTP(wrapped, r)
 		})
@@ -81,48 +92,191 @@ func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
 	return New(mw, DefaultConfig())
 }
 
-// gzipResponseWriter wraps response writer for gzip compression
+// gzipResponseWriter wraps response writer for gzip compression.
+// Whether to compress is decided once the header is written.
 type gzipResponseWriter struct {
 	http.ResponseWriter
-	io.Writer
-	config         *Config
-	headerWritten  bool
-	shouldCompress bool
+	gz            *gzip.Writer
+	pool          *sync.Pool
+	config        *Config
+	headerWritten bool
+	// holds the first writes until MinSize bytes are known to follow
+	buf []byte
+	// set by Bypass, the response is passed through unchanged
+	bypass bool
 }
 
 func (grw *gzipResponseWriter) WriteHeader(code int) {
+	grw.writeHeader(code, 0)
+}
+
+// writeHeader decides on compression and writes the header, size is the
+// known body size or 0 if unknown
+func (grw *gzipResponseWriter) writeHeader(code, size int) {
 	if grw.headerWritten {
 		return
 	}
 	grw.headerWritten = true
 
-	// Check if we should compress based on content type
-	if len(grw.config.Types) > 0 {
-		contentType := grw.Header().Get("Content-Type")
-		grw.shouldCompress = shouldCompressType(contentType, grw.config.Types)
-	} else {
-		grw.shouldCompress = true
+	if grw.shouldCompress(code, size) {
+		h := grw.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		// A strong ETag names the uncompressed bytes
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		grw.gz = grw.pool.Get().(*gzip.Writer)
+		grw.gz.Reset(grw.ResponseWriter)
 	}
 
 	grw.ResponseWriter.WriteHeader(code)
 }
 
 func (grw *gzipResponseWriter) Write(data []byte) (int, error) {
-	if !grw.headerWritten {
-		grw.WriteHeader(http.StatusOK)
+	if grw.headerWritten {
+		return grw.write(data)
 	}
 
-	// Check minimum size
-	if len(data) < grw.config.MinSize && !grw.shouldCompress {
-		return grw.ResponseWriter.Write(data)
+	// Without Content-Length the body is held back until it reaches
+	// MinSize, handlers like html/template start with small writes
+	if !grw.bypass && grw.config.MinSize > 0 && grw.Header().Get("Content-Length") == "" {
+		if len(grw.buf)+len(data) < grw.config.MinSize {
+			grw.buf = append(grw.buf, data...)
+			return len(data), nil
+		}
+		if len(grw.buf) == 0 {
+			grw.sniff(data)
+		}
+		if err := grw.flushBuffer(len(grw.buf) + len(data)); err != nil {
+			return 0, err
+		}
+		return grw.write(data)
 	}
 
-	if grw.shouldCompress {
-		return grw.Writer.Write(data)
+	grw.sniff(data)
+	grw.writeHeader(http.StatusOK, 0)
+	return grw.write(data)
+}
+
+func (grw *gzipResponseWriter) write(data []byte) (int, error) {
+	if grw.gz != nil {
+		return grw.gz.Write(data)
 	}
 	return grw.ResponseWriter.Write(data)
 }
 
+// flushBuffer writes the header and the held back body, size is the known
+// body size or 0 if unknown
+func (grw *gzipResponseWriter) flushBuffer(size int) error {
+	grw.sniff(grw.buf)
+	grw.writeHeader(http.StatusOK, size)
+	if len(grw.buf) == 0 {
+		return nil
+	}
+
+	_, err := grw.write(grw.buf)
+	grw.buf = grw.buf[:0]
+	return err
+}
+
+// sniff sets the content type like net/http would, so the type check sees one
+func (grw *gzipResponseWriter) sniff(data []byte) {
+	if h := grw.Header(); h.Get("Content-Type") == "" && len(data) > 0 {
+		h.Set("Content-Type", http.DetectContentType(data))
+	}
+}
+
+// Flush sends compressed data written so far to the client
+func (grw *gzipResponseWriter) Flush() {
+	grw.FlushError()
+}
+
+// FlushError is Flush reporting whether the underlying writer supports
+// flushing, http.ResponseController prefers it over Flush
+func (grw *gzipResponseWriter) FlushError() error {
+	// A streaming handler wants its data now, the final size is unknown
+	if !grw.headerWritten {
+		if err := grw.flushBuffer(0); err != nil {
+			return err
+		}
+	}
+	if grw.gz != nil {
+		if err := grw.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(grw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (grw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return grw.ResponseWriter
+}
+
+func (grw *gzipResponseWriter) shouldCompress(code, size int) bool {
+	h := grw.Header()
+
+	// Already encoded, e.g. precompressed static files
+	if grw.bypass || h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+
+	if cl := h.Get("Content-Length"); cl != "" {
+		size, _ = strconv.Atoi(cl)
+	}
+	if size > 0 && size < grw.config.MinSize {
+		return false
+	}
+
+	// Check if we should compress based on content type
+	if len(grw.config.Types) > 0 {
+		return shouldCompressType(h.Get("Content-Type"), grw.config.Types)
+	}
+	return true
+}
+
+// close writes a body still held back, finishes the gzip stream and resets
+// the writer for reuse
+func (grw *gzipResponseWriter) close() {
+	if !grw.headerWritten && len(grw.buf) > 0 {
+		grw.flushBuffer(len(grw.buf))
+	}
+	if grw.gz != nil {
+		grw.gz.Close()
+		grw.gz.Reset(io.Discard)
+		grw.pool.Put(grw.gz)
+	}
+
+	buf := grw.buf[:0]
+	*grw = gzipResponseWriter{buf: buf}
+}
+
+// Bypass turns off compression for the response written to w, e.g. for
+// files with precompressed variants or range requests. It looks through
+// wrappers that implement Unwrap and must be called before the header is
+// written. It reports whether a gzip writer was found.
+func Bypass(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case *gzipResponseWriter:
+			if !rw.headerWritten {
+				rw.bypass = true
+			}
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
 func acceptsGzip(r *http.Request) bool {
 	return strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
 }
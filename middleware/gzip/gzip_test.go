@@ -0,0 +1,198 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestCompressDecision(t *testing.T) {
+	large := strings.Repeat("a", 2048)
+	small := "tiny"
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    bool
+	}{
+		{
+			name: "large first write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(large))
+			},
+			want: true,
+		},
+		{
+			// The body is held back until MinSize is reached
+			name: "small first write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(small))
+				w.Write([]byte(large))
+			},
+			want: true,
+		},
+		{
+			name: "many small writes",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				for range 100 {
+					w.Write([]byte(strings.Repeat("x", 100)))
+				}
+			},
+			want: true,
+		},
+		{
+			name: "small total",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(small))
+				w.Write([]byte(small))
+			},
+			want: false,
+		},
+		{
+			// A streaming handler can't wait for MinSize
+			name: "flush before min size",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(small))
+				http.NewResponseController(w).Flush()
+				w.Write([]byte(small))
+			},
+			want: true,
+		},
+		{
+			name: "small content length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", strconv.Itoa(len(small)))
+				w.Write([]byte(small))
+			},
+			want: false,
+		},
+		{
+			// Decided at WriteHeader, before any body is known
+			name: "explicit write header",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(small))
+			},
+			want: true,
+		},
+		{
+			name: "already encoded",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "br")
+				w.Write([]byte(large))
+			},
+			want: false,
+		},
+		{
+			name: "type not listed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte(large))
+			},
+			want: false,
+		},
+		{
+			name: "sniffed type",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(large))
+			},
+			want: true,
+		},
+		{
+			name: "no content",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			want: false,
+		},
+		{
+			name: "bypass",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				Bypass(w)
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(large))
+			},
+			want: false,
+		},
+	}
+
+	h := Handler(middleware.New(nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+			h(tt.handler).ServeHTTP(rec, req)
+
+			compressed := rec.Header().Get("Content-Encoding") == "gzip"
+			if compressed != tt.want {
+				t.Fatalf("compressed = %v, want %v", compressed, tt.want)
+			}
+
+			// Held back writes must all arrive
+			plain := httptest.NewRecorder()
+			tt.handler(plain, req)
+			body := rec.Body.Bytes()
+
+			if compressed {
+				if rec.Header().Get("Content-Length") != "" {
+					t.Error("Content-Length kept on compressed response")
+				}
+				gz, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(gz); err != nil {
+					t.Errorf("invalid gzip stream: %v", err)
+				}
+			}
+			if !bytes.Equal(body, plain.Body.Bytes()) {
+				t.Errorf("body has %d bytes, want %d", len(body), plain.Body.Len())
+			}
+		})
+	}
+}
+
+func TestNoAcceptEncoding(t *testing.T) {
+	h := Handler(middleware.New(nil))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("a", 2048)))
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 2048 {
+		t.Errorf("response compressed without Accept-Encoding")
+	}
+}
+
+func TestWeakensETag(t *testing.T) {
+	h := Handler(middleware.New(nil))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(strings.Repeat("a", 2048)))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if got := rec.Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf(`ETag = %q, want W/"v1"`, got)
+	}
+}
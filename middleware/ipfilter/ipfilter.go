@@ -0,0 +1,264 @@
+// Package ipfilter provides IP allow and deny list middleware
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/realip"
+)
+
+// Rule restricts Path and every path below it, matched on whole segments so
+// "/admin" covers "/admin/users" but not "/administrator". Segments written
+// as {name}, like in http.ServeMux patterns, match any single segment.
+// The most specific matching rule applies: the one with the most segments,
+// and among those the one with literal segments where others have {name}.
+type Rule struct {
+	Path string `json:"path"`
+	// Only these CIDRs may access Path (if empty, everyone not denied may)
+	Allow []string `json:"allow"`
+	// These CIDRs are rejected, even if allowed
+	Deny []string `json:"deny"`
+}
+
+// Config holds IP filter configuration
+type Config struct {
+	Rules []Rule
+	// Optional JSON file with {"rules": [...]} loaded by Reload
+	// Rules from the file replace Rules
+	File string
+}
+
+// DefaultConfig returns a config without rules, which allows everyone
+func DefaultConfig() *Config {
+	return &Config{}
+}
+
+// Filter is IP filter middleware whose rules can be replaced at runtime
+type Filter struct {
+	mw     *middleware.Middleware
+	file   string
+	rules  atomic.Pointer[[]compiledRule]
+	loaded atomic.Int64 // file modification time in unix nanos
+}
+
+type compiledRule struct {
+	path     string
+	segments []string
+	allow    *trie
+	deny     *trie
+}
+
+// New creates an IP filter. If config.File is set the rules are loaded from it.
+func New(mw *middleware.Middleware, config *Config) (*Filter, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	f := &Filter{mw: mw, file: config.File}
+
+	if config.File != "" {
+		if err := f.Reload(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	if err := f.SetRules(config.Rules); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Handler filters requests, use it as middleware.MiddlewareFunc
+func (f *Filter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.mw.ShouldSkip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		addr := realip.FromRequest(r)
+		if f.Allowed(r.URL.Path, addr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		traceID := middleware.GetTraceIDFromContext(r.Context())
+
+		f.mw.Logger().Warn("ip rejected",
+			slog.String("trace_id", traceID),
+			slog.String("ip", addr.String()),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":    "forbidden",
+			"trace_id": traceID,
+		})
+	})
+}
+
+// Allowed reports whether addr may access path
+func (f *Filter) Allowed(path string, addr netip.Addr) bool {
+	rules := *f.rules.Load()
+
+	// Rules are sorted by specificity, so the first match is the most specific
+	for _, rule := range rules {
+		if !middleware.MatchPath(path, rule.path) {
+			continue
+		}
+		if !addr.IsValid() {
+			return false
+		}
+		if rule.deny.contains(addr) {
+			return false
+		}
+		if !rule.allow.empty() && !rule.allow.contains(addr) {
+			return false
+		}
+		return true
+	}
+
+	return true
+}
+
+// specificity orders rules so the most specific comes first: more segments
+// first, then literal segments before {name} wildcards
+func specificity(a, b compiledRule) int {
+	if n := len(b.segments) - len(a.segments); n != 0 {
+		return n
+	}
+	for i := range a.segments {
+		aWild, bWild := isWildcard(a.segments[i]), isWildcard(b.segments[i])
+		if aWild != bWild {
+			if aWild {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func isWildcard(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// SetRules replaces all rules atomically
+func (f *Filter) SetRules(rules []Rule) error {
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for _, rule := range rules {
+		allow, err := realip.ParsePrefixes(rule.Allow)
+		if err != nil {
+			return fmt.Errorf("ipfilter: rule %q: %w", rule.Path, err)
+		}
+		deny, err := realip.ParsePrefixes(rule.Deny)
+		if err != nil {
+			return fmt.Errorf("ipfilter: rule %q: %w", rule.Path, err)
+		}
+		compiled = append(compiled, compiledRule{
+			path:     rule.Path,
+			segments: splitPath(rule.Path),
+			allow:    newTrie(allow),
+			deny:     newTrie(deny),
+		})
+	}
+
+	slices.SortStableFunc(compiled, specificity)
+
+	f.rules.Store(&compiled)
+	return nil
+}
+
+// Reload reads the rules file again.
+// The current rules stay active if the file is invalid.
+func (f *Filter) Reload() error {
+	if f.file == "" {
+		return fmt.Errorf("ipfilter: no rules file configured")
+	}
+
+	info, err := os.Stat(f.file)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(f.file)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("ipfilter: %s: %w", f.file, err)
+	}
+
+	if err := f.SetRules(file.Rules); err != nil {
+		return err
+	}
+
+	f.loaded.Store(info.ModTime().UnixNano())
+	return nil
+}
+
+// Watch reloads the rules file whenever it changes, checking every interval.
+// Call the returned function to stop watching.
+func (f *Filter) Watch(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(f.file)
+				if err != nil || info.ModTime().UnixNano() == f.loaded.Load() {
+					continue
+				}
+				// Remember the version even if it is invalid so we log once
+				f.loaded.Store(info.ModTime().UnixNano())
+				if err := f.Reload(); err != nil {
+					f.mw.Logger().Error("ipfilter reload failed",
+						slog.String("file", f.file),
+						slog.String("error", err.Error()),
+					)
+					continue
+				}
+				f.mw.Logger().Info("ipfilter rules reloaded", slog.String("file", f.file))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
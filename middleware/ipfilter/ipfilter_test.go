@@ -0,0 +1,148 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestAllowed(t *testing.T) {
+	f, err := New(middleware.New(nil), &Config{
+		Rules: []Rule{
+			{Path: "/admin", Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.6.6.0/24"}},
+			{Path: "/admin/public"},
+			{Path: "/tenants/{id}/billing", Allow: []string{"10.0.0.0/8"}},
+			{Path: "/", Deny: []string{"203.0.113.7"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		ip   string
+		want bool
+	}{
+		{"/admin/users", "10.1.2.3", true},
+		{"/admin/users", "10.6.6.1", false},
+		{"/admin/users", "192.168.1.1", false},
+		{"/admin/users", "2001:db8::1", true},
+		{"/admin/users", "2001:db9::1", false},
+		{"/admin/users", "::ffff:10.1.2.3", true},
+		{"/admin/public/logo.png", "192.168.1.1", true},
+		{"/admin", "192.168.1.1", false},
+		{"/administrator", "192.168.1.1", true},
+		{"/tenants/7/billing/invoices", "192.168.1.1", false},
+		{"/tenants/7/billing/invoices", "10.1.2.3", true},
+		{"/tenants/7/billingx", "192.168.1.1", true},
+		{"/tenants/7/users", "192.168.1.1", true},
+		{"/", "203.0.113.7", false},
+		{"/", "203.0.113.8", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.ip, func(t *testing.T) {
+			if got := f.Allowed(tt.path, netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Errorf("Allowed(%q, %s) = %v, want %v", tt.path, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleSpecificity(t *testing.T) {
+	// The wildcard rule has the longer Path but is less specific
+	f, err := New(middleware.New(nil), &Config{
+		Rules: []Rule{
+			{Path: "/api/{version}"},
+			{Path: "/api/v1/admin", Allow: []string{"10.0.0.0/8"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		path string
+		ip   string
+		want bool
+	}{
+		{"/api/v1/admin/x", "192.168.1.1", false},
+		{"/api/v1/admin/x", "10.1.2.3", true},
+		{"/api/v1/users", "192.168.1.1", true},
+	}
+
+	for _, tt := range tests {
+		if got := f.Allowed(tt.path, netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("Allowed(%q, %s) = %v, want %v", tt.path, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerRejects(t *testing.T) {
+	f, err := New(middleware.New(nil), &Config{
+		Rules: []Rule{{Path: "/admin", Allow: []string{"10.0.0.0/8"}}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	h := f.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON response, got %q", ct)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	write := func(rules []Rule) {
+		data, _ := json.Marshal(map[string][]Rule{"rules": rules})
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write([]Rule{{Path: "/", Deny: []string{"192.0.2.0/24"}}})
+	f, err := New(middleware.New(nil), &Config{File: path})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	addr := netip.MustParseAddr("192.0.2.1")
+	if f.Allowed("/", addr) {
+		t.Error("Address should be denied")
+	}
+
+	write([]Rule{})
+	if err := f.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !f.Allowed("/", addr) {
+		t.Error("Address should be allowed after reload")
+	}
+
+	os.WriteFile(path, []byte("{invalid"), 0o644)
+	if err := f.Reload(); err == nil {
+		t.Error("Expected error for invalid file")
+	}
+	if !f.Allowed("/", addr) {
+		t.Error("Previous rules should stay active")
+	}
+}
@@ -0,0 +1,75 @@
+package ipfilter
+
+import "net/netip"
+
+// trie is a binary prefix trie over address bits.
+// IPv4 and IPv6 live in separate roots so 4-in-6 addresses can't collide.
+type trie struct {
+	v4 *node
+	v6 *node
+}
+
+type node struct {
+	children [2]*node
+	terminal bool
+}
+
+func newTrie(prefixes []netip.Prefix) *trie {
+	t := &trie{v4: &node{}, v6: &node{}}
+	for _, p := range prefixes {
+		t.insert(p)
+	}
+	return t
+}
+
+func (t *trie) insert(p netip.Prefix) {
+	n := t.root(p.Addr())
+	bytes := p.Addr().AsSlice()
+
+	for i := range p.Bits() {
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &node{}
+		}
+		n = n.children[bit]
+		if n.terminal {
+			// A shorter prefix already covers this one
+			return
+		}
+	}
+	n.terminal = true
+	n.children = [2]*node{}
+}
+
+// contains reports whether any inserted prefix contains addr
+func (t *trie) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	n := t.root(addr)
+	if n.terminal {
+		return true
+	}
+
+	bytes := addr.AsSlice()
+	for i := range addr.BitLen() {
+		n = n.children[bytes[i/8]>>(7-i%8)&1]
+		if n == nil {
+			return false
+		}
+		if n.terminal {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *trie) empty() bool {
+	return !t.v4.terminal && !t.v6.terminal &&
+		t.v4.children == [2]*node{} && t.v6.children == [2]*node{}
+}
+
+func (t *trie) root(addr netip.Addr) *node {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
@@ -0,0 +1,190 @@
+// Package locale provides Accept-Language negotiation middleware
+//
+// The chosen locale is stored in the request context, handlers, responders
+// and validators read it with FromContext to pick their messages.
+package locale
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+type contextKey struct{}
+
+// Config holds locale configuration
+type Config struct {
+	// Locales the application supports, e.g. "en", "de", "de-CH"
+	Supported []string
+	// Locale used when nothing matches, should be in Supported
+	Default string
+	// Cookie that overrides Accept-Language, empty disables it
+	Cookie string
+	// Query parameter that overrides cookie and Accept-Language, empty disables it
+	QueryParam string
+}
+
+// DefaultConfig supports English only
+func DefaultConfig() *Config {
+	return &Config{
+		Supported:  []string{"en"},
+		Default:    "en",
+		Cookie:     "lang",
+		QueryParam: "lang",
+	}
+}
+
+// New creates locale middleware with custom config
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	vary := "Accept-Language"
+	if config.Cookie != "" {
+		vary += ", Cookie"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			locale := Negotiate(r, config)
+
+			w.Header().Set("Content-Language", locale)
+			w.Header().Add("Vary", vary)
+
+			next.ServeHTTP(w, r.WithContext(ContextWithLocale(r.Context(), locale)))
+		})
+	}
+}
+
+// Handler creates locale middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+// Negotiate picks the locale for r: query parameter, then cookie,
+// then Accept-Language and finally the default
+func Negotiate(r *http.Request, config *Config) string {
+	if config.QueryParam != "" {
+		if value := r.URL.Query().Get(config.QueryParam); value != "" {
+			if locale, ok := Match([]Language{{Tag: value, Q: 1}}, config.Supported); ok {
+				return locale
+			}
+		}
+	}
+
+	if config.Cookie != "" {
+		if cookie, err := r.Cookie(config.Cookie); err == nil && cookie.Value != "" {
+			if locale, ok := Match([]Language{{Tag: cookie.Value, Q: 1}}, config.Supported); ok {
+				return locale
+			}
+		}
+	}
+
+	if locale, ok := Match(ParseAcceptLanguage(r.Header.Get("Accept-Language")), config.Supported); ok {
+		return locale
+	}
+
+	return config.Default
+}
+
+// ContextWithLocale returns a copy of ctx carrying locale
+func ContextWithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale stored by the middleware, "" if none
+func FromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(contextKey{}).(string)
+	return locale
+}
+
+// Language is one entry of an Accept-Language header
+type Language struct {
+	Tag string
+	Q   float64
+}
+
+// ParseAcceptLanguage parses an Accept-Language header. Entries are sorted
+// by q-value, entries with equal q-values keep their order, q=0 is dropped.
+// Example: "de-CH, de;q=0.9, en;q=0.5"
+func ParseAcceptLanguage(header string) []Language {
+	var languages []Language
+
+	for part := range strings.SplitSeq(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(key, "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		if q == 0 {
+			continue
+		}
+
+		languages = append(languages, Language{Tag: tag, Q: q})
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].Q > languages[j].Q })
+	return languages
+}
+
+// Match returns the supported locale that best fits the preferences.
+// For each preference it tries an exact match, then the base language
+// ("de-AT" matches "de") and then a regional variant ("de" matches "de-CH").
+func Match(preferences []Language, supported []string) (string, bool) {
+	for _, pref := range preferences {
+		if pref.Tag == "*" {
+			continue
+		}
+
+		for _, locale := range supported {
+			if strings.EqualFold(locale, pref.Tag) {
+				return locale, true
+			}
+		}
+
+		base := baseLanguage(pref.Tag)
+		for _, locale := range supported {
+			if strings.EqualFold(locale, base) {
+				return locale, true
+			}
+		}
+		for _, locale := range supported {
+			if strings.EqualFold(baseLanguage(locale), base) {
+				return locale, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// baseLanguage strips script and region, "zh-Hant-TW" becomes "zh"
+func baseLanguage(tag string) string {
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
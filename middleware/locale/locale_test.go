@@ -0,0 +1,64 @@
+package locale
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestNegotiate(t *testing.T) {
+	config := DefaultConfig()
+	config.Supported = []string{"en", "de", "fr-CH"}
+
+	tests := []struct {
+		name   string
+		accept string
+		cookie string
+		query  string
+		want   string
+	}{
+		{"exact", "de", "", "", "de"},
+		{"q-values", "en;q=0.5, de;q=0.8", "", "", "de"},
+		{"regional to base", "de-AT, en;q=0.9", "", "", "de"},
+		{"base to regional", "fr", "", "", "fr-CH"},
+		{"q=0 excluded", "de;q=0, en;q=0.1", "", "", "en"},
+		{"no match", "ja, zh-Hant-TW", "", "", "en"},
+		{"cookie overrides header", "de", "fr-CH", "", "fr-CH"},
+		{"query overrides cookie", "de", "fr-CH", "en", "en"},
+		{"unsupported override ignored", "de", "", "ja", "de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := New(middleware.New(nil), config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = FromContext(r.Context())
+			}))
+
+			url := "/"
+			if tt.query != "" {
+				url += "?lang=" + tt.query
+			}
+			r := httptest.NewRequest(http.MethodGet, url, nil)
+			r.Header.Set("Accept-Language", tt.accept)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "lang", Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got != tt.want {
+				t.Errorf("Expected locale %q, got %q", tt.want, got)
+			}
+			if w.Header().Get("Content-Language") != tt.want {
+				t.Errorf("Expected Content-Language %q, got %q", tt.want, w.Header().Get("Content-Language"))
+			}
+			if w.Header().Get("Vary") != "Accept-Language, Cookie" {
+				t.Errorf("Unexpected Vary %q", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
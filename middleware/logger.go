@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// contextAttrs maps context keys to the log attribute they become
+var contextAttrs = []struct {
+	key  contextKey
+	attr string
+}{
+	{TraceIDKey, "trace_id"},
+	{RequestIDKey, "request_id"},
+	{UserIDKey, "user_id"},
+	{TenantIDKey, "tenant_id"},
+}
+
+// ContextHandler is a slog.Handler that adds trace_id, request_id, user_id
+// and tenant_id from the context passed to InfoContext and friends.
+// Example: slog.New(middleware.NewContextHandler(slog.NewJSONHandler(os.Stdout, nil)))
+type ContextHandler struct {
+	slog.Handler
+	// bound holds attributes already added with WithAttrs, e.g. by the
+	// per-request logger, so they aren't logged twice
+	bound map[string]bool
+}
+
+// NewContextHandler wraps h
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+// Handle adds the context attributes and passes the record on
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	for _, ca := range contextAttrs {
+		if h.bound[ca.attr] {
+			continue
+		}
+		switch v := ctx.Value(ca.key).(type) {
+		case nil:
+		case string:
+			r.AddAttrs(slog.String(ca.attr, v))
+		default:
+			r.AddAttrs(slog.Any(ca.attr, v))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a ContextHandler whose inner handler has attrs
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	bound := make(map[string]bool, len(h.bound)+len(attrs))
+	for k := range h.bound {
+		bound[k] = true
+	}
+	for _, a := range attrs {
+		bound[a.Key] = true
+	}
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs), bound: bound}
+}
+
+// WithGroup returns a ContextHandler whose inner handler has the group
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name), bound: h.bound}
+}
+
+// ContextWithLogger returns a copy of ctx carrying logger
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, LoggerKey, logger)
+}
+
+// LoggerFromContext returns the per-request logger stored by LogRequest.
+// It falls back to slog.Default().
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	return LoggerFromContextOr(ctx, slog.Default())
+}
+
+// LoggerFromContextOr is like LoggerFromContext but falls back to fallback,
+// e.g. a component's own logger
+func LoggerFromContextOr(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(LoggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	if fallback == nil {
+		return slog.Default()
+	}
+	return fallback
+}
+
+// requestContext carries the trace ID and the per-request logger in a
+// single allocation. The logger is only built when someone asks for it.
+type requestContext struct {
+	context.Context
+	traceID string
+	base    *slog.Logger
+	logger  atomic.Pointer[slog.Logger]
+
+	// attrs are added to the request log entry, see AddRequestAttrs
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type requestContextKey struct{}
+
+// AddRequestAttrs adds attributes to the request log entry written by
+// LogRequest once the handler returned, e.g. a tenant resolved further down
+// the chain. It does nothing if ctx doesn't come from LogRequest.
+func AddRequestAttrs(ctx context.Context, attrs ...slog.Attr) {
+	rc, ok := ctx.Value(requestContextKey{}).(*requestContext)
+	if !ok {
+		return
+	}
+	rc.mu.Lock()
+	rc.attrs = append(rc.attrs, attrs...)
+	rc.mu.Unlock()
+}
+
+func (c *requestContext) appendAttrs(attrs []slog.Attr) []slog.Attr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append(attrs, c.attrs...)
+}
+
+func (c *requestContext) Value(key any) any {
+	switch key {
+	case requestContextKey{}:
+		return c
+	case TraceIDKey:
+		return c.traceID
+	case LoggerKey:
+		if logger := c.logger.Load(); logger != nil {
+			return logger
+		}
+		logger := c.base.With(slog.String("trace_id", c.traceID))
+		if !c.logger.CompareAndSwap(nil, logger) {
+			logger = c.logger.Load()
+		}
+		return logger
+	}
+	return c.Context.Value(key)
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContextHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewJSONHandler(&out, nil)))
+
+	ctx := context.WithValue(context.Background(), TraceIDKey, "trace-1")
+	ctx = context.WithValue(ctx, UserIDKey, "user-42")
+	logger.InfoContext(ctx, "hello")
+
+	line := out.String()
+	for _, want := range []string{`"trace_id":"trace-1"`, `"user_id":"user-42"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log lacks %s: %s", want, line)
+		}
+	}
+	for _, unset := range []string{"request_id", "tenant_id"} {
+		if strings.Contains(line, unset) {
+			t.Errorf("log has unset %s: %s", unset, line)
+		}
+	}
+}
+
+func TestContextHandlerBoundAttrs(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewJSONHandler(&out, nil)))
+
+	// Like the per-request logger, which binds trace_id with With
+	ctx := context.WithValue(context.Background(), TraceIDKey, "trace-1")
+	logger.With(slog.String("trace_id", "trace-1")).WithGroup("req").InfoContext(ctx, "hello")
+
+	if n := strings.Count(out.String(), "trace_id"); n != 1 {
+		t.Errorf("trace_id logged %d times: %s", n, out.String())
+	}
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	var out bytes.Buffer
+	mw := New(slog.New(slog.NewJSONHandler(&out, nil)))
+
+	var logger *slog.Logger
+	h := mw.LogRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger = LoggerFromContext(r.Context())
+		logger.Info("inside")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	first, _, _ := strings.Cut(out.String(), "\n")
+	if !strings.Contains(first, `"msg":"inside"`) || !strings.Contains(first, `"trace_id":"`) {
+		t.Errorf("per-request logger lacks trace_id: %s", first)
+	}
+
+	fallback := slog.New(slog.DiscardHandler)
+	if LoggerFromContextOr(context.Background(), fallback) != fallback {
+		t.Error("LoggerFromContextOr ignored the fallback")
+	}
+	if LoggerFromContext(context.Background()) != slog.Default() {
+		t.Error("LoggerFromContext without logger is not slog.Default()")
+	}
+}
@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/bit8bytes/toolbox/tracing"
 )
 
 type contextKey string
@@ -15,12 +21,19 @@ const (
 	TraceIDKey   contextKey = "trace_id"
 	UserIDKey    contextKey = "user_id"
 	RequestIDKey contextKey = "request_id"
+	LoggerKey    contextKey = "logger"
+	MediaTypeKey contextKey = "media_type"
+	TenantIDKey  contextKey = "tenant_id"
+
+	// mediaTypeSlotKey holds the *string RecoverPanic reads after a panic
+	mediaTypeSlotKey contextKey = "media_type_slot"
 )
 
 type MiddlewareFunc func(http.Handler) http.Handler
 
 type Middleware struct {
 	logger         *slog.Logger
+	tracer         *tracing.Tracer
 	excludedPaths  map[string]bool
 	excludedPrefix []string
 }
@@ -39,16 +52,15 @@ func New(logger *slog.Logger) *Middleware {
 	return mw
 }
 
-// Chain combines middlewares and returns a handler.
-// Build chain from right to left
-func (m *Middleware) Chain(middlewares ...MiddlewareFunc) MiddlewareFunc {
-	return func(handler http.Handler) http.Handler {
-		// Build chain from right to left
-		for i := len(middlewares) - 1; i >= 0; i-- {
-			handler = middlewares[i](handler)
-		}
-		return handler
-	}
+// Logger returns the logger used by the middleware
+func (m *Middleware) Logger() *slog.Logger {
+	return m.logger
+}
+
+// SetTracer enables a server span per request in LogRequest
+// The trace ID in the context is then the span's trace ID
+func (m *Middleware) SetTracer(tracer *tracing.Tracer) {
+	m.tracer = tracer
 }
 
 // ExcludePaths excludes exact path matches
@@ -84,6 +96,32 @@ func (m *Middleware) ShouldSkip(r *http.Request) bool {
 	return false
 }
 
+// MatchPath reports whether path is pattern or below it. Paths are compared
+// on whole segments, so "/admin" matches "/admin/users" but not
+// "/administrator". Segments written as {name}, like in http.ServeMux
+// patterns, match any single segment.
+func MatchPath(path, pattern string) bool {
+	pattern = strings.Trim(pattern, "/")
+	path = strings.Trim(path, "/")
+
+	for pattern != "" {
+		want, restPattern, _ := strings.Cut(pattern, "/")
+		got, restPath, _ := strings.Cut(path, "/")
+		if got == "" {
+			return false
+		}
+		if !isWildcard(want) && want != got {
+			return false
+		}
+		pattern, path = restPattern, restPath
+	}
+	return true
+}
+
+func isWildcard(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
 // LogRequest logs HTTP requests with response details
 func (m *Middleware) LogRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -93,35 +131,72 @@ func (m *Middleware) LogRequest(next http.Handler) http.Handler {
 		}
 
 		start := time.Now()
-		traceID := getTraceID(r)
+		ctx := r.Context()
+
+		var (
+			traceID string
+			span    *tracing.Span
+		)
+		if m.tracer != nil {
+			ctx, span = m.startSpan(ctx, r)
+			traceID = span.SpanContext().TraceID.String()
+		} else {
+			traceID = getTraceID(r)
+		}
 
-		// Add trace ID to context
-		ctx := context.WithValue(r.Context(), TraceIDKey, traceID)
-		r = r.WithContext(ctx)
+		// Add trace ID and a logger carrying it to context
+		rc := &requestContext{Context: ctx, traceID: traceID, base: m.logger}
+		r = r.WithContext(rc)
 
 		// Wrap response writer to capture status and size
-		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		wrapped := acquireResponseWriter(w)
+		defer releaseResponseWriter(wrapped)
 
 		next.ServeHTTP(wrapped, r)
 
-		m.logger.Info("request",
+		if span != nil {
+			endSpan(span, r, wrapped.StatusCode())
+		}
+
+		if !m.logger.Enabled(ctx, slog.LevelInfo) {
+			return
+		}
+
+		attrs := []slog.Attr{
 			slog.String("trace_id", traceID),
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
-			slog.Int("status", wrapped.statusCode),
-			slog.Int("size", wrapped.size),
+			slog.Int("status", wrapped.StatusCode()),
+			slog.Int("size", wrapped.Size()),
 			slog.Duration("duration", time.Since(start)),
-		)
+		}
+		m.logger.LogAttrs(ctx, slog.LevelInfo, "request", rc.appendAttrs(attrs)...)
 	})
 }
 
+// ContextWithMediaType returns a copy of ctx carrying the negotiated media type.
+// It also reports the type to an enclosing RecoverPanic, which cannot see
+// values added to the context further down the chain.
+func ContextWithMediaType(ctx context.Context, mediaType string) context.Context {
+	if slot, ok := ctx.Value(mediaTypeSlotKey).(*string); ok {
+		*slot = mediaType
+	}
+	return context.WithValue(ctx, MediaTypeKey, mediaType)
+}
+
 // RecoverPanic recovers from panics
+// The response is plain text if text/plain was negotiated, before or after it
 func (m *Middleware) RecoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slot := new(string)
+		r = r.WithContext(context.WithValue(r.Context(), mediaTypeSlotKey, slot))
+
 		defer func() {
 			if err := recover(); err != nil {
 				traceID := GetTraceIDFromContext(r.Context())
 
+				tracing.SpanFromContext(r.Context()).RecordError(fmt.Errorf("panic: %v", err))
+
 				m.logger.Error("panic recovered",
 					slog.String("trace_id", traceID),
 					slog.String("method", r.Method),
@@ -129,6 +204,18 @@ func (m *Middleware) RecoverPanic(next http.Handler) http.Handler {
 					slog.Any("error", err),
 				)
 
+				// Answer in the format content negotiation picked, JSON otherwise
+				mediaType := *slot
+				if mediaType == "" {
+					mediaType, _ = r.Context().Value(MediaTypeKey).(string)
+				}
+				if strings.HasPrefix(mediaType, "text/plain") {
+					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "internal server error (trace id %s)\n", traceID)
+					return
+				}
+
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, `{"error":"internal server error","trace_id":"%s"}`, traceID)
@@ -139,24 +226,125 @@ func (m *Middleware) RecoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// responseWriter captures response metadata
-type responseWriter struct {
+// ResponseWriter captures response metadata
+type ResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	size       int
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
+// NewResponseWriter wraps w to capture status and size
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+var responseWriterPool = sync.Pool{
+	New: func() any { return new(ResponseWriter) },
+}
+
+// acquireResponseWriter is NewResponseWriter backed by a pool.
+// The wrapper must not be used after releaseResponseWriter.
+func acquireResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	rw := responseWriterPool.Get().(*ResponseWriter)
+	rw.ResponseWriter = w
+	rw.statusCode = http.StatusOK
+	rw.size = 0
+	return rw
+}
+
+func releaseResponseWriter(rw *ResponseWriter) {
+	rw.ResponseWriter = nil
+	responseWriterPool.Put(rw)
+}
+
+func (rw *ResponseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func (rw *responseWriter) Write(data []byte) (int, error) {
+func (rw *ResponseWriter) Write(data []byte) (int, error) {
 	size, err := rw.ResponseWriter.Write(data)
 	rw.size += size
 	return size, err
 }
 
+// StatusCode returns the response status, 200 if none was written
+func (rw *ResponseWriter) StatusCode() int {
+	return rw.statusCode
+}
+
+// Size returns the number of body bytes written
+func (rw *ResponseWriter) Size() int {
+	return rw.size
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// CaptureWriter is a ResponseWriter that also keeps a copy of the first
+// limit bytes of the response body, e.g. for audit logs or recordings
+type CaptureWriter struct {
+	*ResponseWriter
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// NewCaptureWriter wraps w to capture status, size and up to limit body bytes
+func NewCaptureWriter(w http.ResponseWriter, limit int) *CaptureWriter {
+	return &CaptureWriter{ResponseWriter: NewResponseWriter(w), limit: limit}
+}
+
+func (cw *CaptureWriter) Write(data []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(data)
+
+	captured := data[:n]
+	if remaining := cw.limit - cw.buf.Len(); remaining < len(captured) {
+		cw.truncated = true
+		captured = captured[:max(remaining, 0)]
+	}
+	cw.buf.Write(captured)
+
+	return n, err
+}
+
+// Body returns the captured body
+func (cw *CaptureWriter) Body() []byte {
+	return cw.buf.Bytes()
+}
+
+// Truncated reports whether the body was longer than the limit
+func (cw *CaptureWriter) Truncated() bool {
+	return cw.truncated
+}
+
+// Flush keeps streaming handlers working behind the capture
+func (cw *CaptureWriter) Flush() {
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// PeekBody reads up to limit bytes of the request body and puts them back in
+// front of the rest, so the handler still reads the whole body.
+// truncated reports whether the body is longer than limit.
+func PeekBody(r *http.Request, limit int) (body []byte, truncated bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false, nil
+	}
+
+	// One extra byte tells us whether the body was truncated
+	read, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(read), r.Body), Closer: r.Body}
+
+	return read[:min(len(read), limit)], len(read) > limit, err
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
 // GetTraceIDFromContext returns the trace id from the context
 func GetTraceIDFromContext(ctx context.Context) string {
 	if id, ok := ctx.Value(TraceIDKey).(string); ok {
@@ -166,14 +354,47 @@ func GetTraceIDFromContext(ctx context.Context) string {
 }
 
 // Helper functions
-func getTraceID(r *http.Request) string {
-	headers := []string{"X-Trace-Id", "X-Request-Id", "X-Correlation-Id"}
+func (m *Middleware) startSpan(ctx context.Context, r *http.Request) (context.Context, *tracing.Span) {
+	// Continue the caller's trace if it sent a traceparent header
+	if sc, ok := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); ok {
+		ctx = tracing.ContextWithRemoteParent(ctx, sc)
+	}
 
-	for _, header := range headers {
+	return m.tracer.Start(ctx, r.Method,
+		tracing.WithKind(tracing.KindServer),
+		tracing.WithAttributes(
+			slog.String("http.request.method", r.Method),
+			slog.String("url.path", r.URL.Path),
+			slog.String("user_agent.original", r.UserAgent()),
+		),
+	)
+}
+
+func endSpan(span *tracing.Span, r *http.Request, status int) {
+	// r.Pattern is set by http.ServeMux once the route matched
+	if route := r.Pattern; route != "" {
+		if i := strings.IndexByte(route, ' '); i >= 0 {
+			route = route[i+1:]
+		}
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(slog.String("http.route", route))
+	}
+
+	span.SetAttributes(slog.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(tracing.StatusError, http.StatusText(status))
+	}
+	span.End()
+}
+
+var traceIDHeaders = []string{"X-Trace-Id", "X-Request-Id", "X-Correlation-Id"}
+
+func getTraceID(r *http.Request) string {
+	for _, header := range traceIDHeaders {
 		if id := r.Header.Get(header); id != "" {
 			return id
 		}
 	}
 
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	return strconv.FormatInt(time.Now().UnixNano(), 10)
 }
@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/cors"
+	"github.com/bit8bytes/toolbox/middleware/gzip"
+)
+
+// discardWriter is a reusable http.ResponseWriter so benchmarks only
+// measure the middleware
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func (w *discardWriter) reset() {
+	for k := range w.header {
+		delete(w.header, k)
+	}
+}
+
+var payload = []byte(strings.Repeat(`{"id":1,"name":"toolbox"},`, 100))
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+})
+
+func newMiddleware() *middleware.Middleware {
+	return middleware.New(slog.New(slog.NewJSONHandler(io.Discard, nil)))
+}
+
+func benchmark(b *testing.B, h http.Handler, req *http.Request) {
+	b.Helper()
+
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		w.reset()
+		h.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkLogRequest(b *testing.B) {
+	mw := newMiddleware()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	benchmark(b, mw.LogRequest(okHandler), req)
+}
+
+func BenchmarkLogRequestDisabled(b *testing.B) {
+	// Warn level skips the request log entry
+	mw := middleware.New(slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	benchmark(b, mw.LogRequest(okHandler), req)
+}
+
+func BenchmarkRecoverPanic(b *testing.B) {
+	mw := newMiddleware()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	benchmark(b, mw.RecoverPanic(okHandler), req)
+}
+
+func BenchmarkGzip(b *testing.B) {
+	mw := newMiddleware()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	benchmark(b, gzip.Handler(mw)(okHandler), req)
+}
+
+func BenchmarkCORS(b *testing.B) {
+	mw := newMiddleware()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Origin", "https://example.com")
+	benchmark(b, cors.Handler(mw)(okHandler), req)
+}
+
+func BenchmarkCORSPreflight(b *testing.B) {
+	mw := newMiddleware()
+	req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+	req.Header.Set("Origin", "https://example.com")
+	benchmark(b, cors.Handler(mw)(okHandler), req)
+}
+
+func BenchmarkChain(b *testing.B) {
+	mw := newMiddleware()
+	h := mw.Chain(mw.LogRequest, mw.RecoverPanic, cors.Handler(mw), gzip.Handler(mw)).Then(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Origin", "https://example.com")
+	benchmark(b, h, req)
+}
+
+func BenchmarkChainTimed(b *testing.B) {
+	mw := newMiddleware()
+	h := mw.Chain(mw.LogRequest, mw.RecoverPanic, cors.Handler(mw), gzip.Handler(mw)).
+		WithTiming(middleware.TimingHeader).
+		Then(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Origin", "https://example.com")
+	benchmark(b, h, req)
+}
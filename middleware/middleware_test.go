@@ -0,0 +1,26 @@
+package middleware
+
+import "testing"
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		path, pattern string
+		want          bool
+	}{
+		{"/admin", "/admin", true},
+		{"/admin/users", "/admin", true},
+		{"/admin/users", "/admin/", true},
+		{"/administrator", "/admin", false},
+		{"/", "/admin", false},
+		{"/anything", "/", true},
+		{"/tenants/7/billing/x", "/tenants/{id}/billing", true},
+		{"/tenants/7", "/tenants/{id}/billing", false},
+		{"/tenants/7/billingx", "/tenants/{id}/billing", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPath(tt.path, tt.pattern); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+}
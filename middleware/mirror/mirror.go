@@ -0,0 +1,329 @@
+// Package mirror provides traffic mirroring middleware for shadow testing
+//
+// A sample of requests is copied to a shadow handler or URL after the
+// primary response was written. The shadow response is compared with the
+// primary one and differences are logged with the request's trace ID. The
+// primary response is never affected, shadow failures are only logged.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Header marks requests sent to a shadow URL
+const Header = "X-Mirror"
+
+type contextKey struct{}
+
+// Config holds mirror configuration
+type Config struct {
+	// Shadow handler, e.g. the rewritten implementation
+	Target http.Handler
+	// Shadow base URL, used if Target is nil. Path and query of the
+	// request are appended.
+	URL string
+	// Client for URL (default: http.Client with Timeout)
+	Client *http.Client
+	// Fraction of requests to mirror (0.0 to 1.0)
+	SampleRate float64
+	// Requests with larger bodies are not mirrored, larger responses are
+	// compared by status and headers only
+	MaxBodySize int
+	// Time the shadow may take
+	Timeout time.Duration
+	// Shadow requests running at once, more are not mirrored
+	MaxInFlight int
+	// Response headers compared besides status and body
+	CompareHeaders []string
+}
+
+// DefaultConfig mirrors 10% of requests. Target or URL must still be set.
+func DefaultConfig() *Config {
+	return &Config{
+		SampleRate:     0.1,
+		MaxBodySize:    64 << 10, // 64KB
+		Timeout:        5 * time.Second,
+		MaxInFlight:    32,
+		CompareHeaders: []string{"Content-Type"},
+	}
+}
+
+// New creates mirror middleware with custom config.
+// It panics if neither config.Target nor config.URL is set.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Target == nil && config.URL == "" {
+		panic("mirror: Config.Target or Config.URL is required")
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = DefaultConfig().MaxInFlight
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultConfig().MaxBodySize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig().Timeout
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+
+	inFlight := make(chan struct{}, config.MaxInFlight)
+	m := &mirror{mw: mw, config: config, baseURL: strings.TrimSuffix(config.URL, "/")}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) || IsShadow(r.Context()) || rand.Float64() >= config.SampleRate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// A full shadow pipeline must not slow down or break the primary
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Release the slot unless the shadow took it over, also on panics
+			handedOver := false
+			defer func() {
+				if !handedOver {
+					<-inFlight
+				}
+			}()
+
+			body, truncated, err := middleware.PeekBody(r, config.MaxBodySize)
+			if err != nil || truncated {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Clone before the primary handler can modify the request. The
+			// shadow outlives the request but keeps its values, e.g. the trace ID.
+			ctx := context.WithValue(context.WithoutCancel(r.Context()), contextKey{}, true)
+			req := r.Clone(ctx)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+
+			wrapped := middleware.NewCaptureWriter(w, config.MaxBodySize)
+
+			start := time.Now()
+			next.ServeHTTP(wrapped, r)
+
+			primary := &result{
+				status:    wrapped.StatusCode(),
+				header:    w.Header().Clone(),
+				body:      wrapped.Body(),
+				truncated: wrapped.Truncated(),
+				duration:  time.Since(start),
+			}
+
+			handedOver = true
+			go func() {
+				defer func() { <-inFlight }()
+				m.shadow(req, body, primary)
+			}()
+		})
+	}
+}
+
+// IsShadow reports whether ctx belongs to a mirrored request. Shadow
+// handlers can use it to skip side effects like sending emails.
+func IsShadow(ctx context.Context) bool {
+	shadow, _ := ctx.Value(contextKey{}).(bool)
+	return shadow
+}
+
+type mirror struct {
+	mw      *middleware.Middleware
+	config  *Config
+	baseURL string
+}
+
+// result is a primary or shadow response
+type result struct {
+	status    int
+	header    http.Header
+	body      []byte
+	truncated bool
+	duration  time.Duration
+}
+
+// shadow sends r to the shadow and logs how its response differs
+func (m *mirror) shadow(r *http.Request, body []byte, primary *result) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+	attrs := []any{
+		slog.String("trace_id", traceID),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			m.mw.Logger().Error("mirror shadow panicked", append(attrs, slog.Any("error", err))...)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(r.Context(), m.config.Timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	start := time.Now()
+	var (
+		shadow *result
+		err    error
+	)
+	if m.config.Target != nil {
+		shadow = m.serve(r)
+	} else {
+		shadow, err = m.send(r, body)
+	}
+	if err != nil {
+		m.mw.Logger().Warn("mirror shadow failed", append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	shadow.duration = time.Since(start)
+
+	attrs = append(attrs,
+		slog.Int("primary_status", primary.status),
+		slog.Int("shadow_status", shadow.status),
+		slog.Duration("primary_duration", primary.duration),
+		slog.Duration("shadow_duration", shadow.duration),
+	)
+
+	diffs := m.compare(primary, shadow)
+	if len(diffs) == 0 {
+		m.mw.Logger().Debug("mirror match", attrs...)
+		return
+	}
+	m.mw.Logger().Warn("mirror mismatch", append(attrs, slog.Any("diff", diffs))...)
+}
+
+// serve runs the shadow handler
+func (m *mirror) serve(r *http.Request) *result {
+	rec := &recorder{header: make(http.Header), limit: m.config.MaxBodySize}
+	m.config.Target.ServeHTTP(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return &result{status: rec.status, header: rec.header, body: rec.buf.Bytes(), truncated: rec.truncated}
+}
+
+// send sends r to the shadow URL
+func (m *mirror) send(r *http.Request, body []byte) (*result, error) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, m.baseURL+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Del("Connection")
+	// Let the transport decompress, so bodies compare unencoded
+	req.Header.Del("Accept-Encoding")
+	req.Header.Set(Header, "1")
+	req.Header.Set("X-Trace-Id", middleware.GetTraceIDFromContext(r.Context()))
+
+	resp, err := m.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	read, err := io.ReadAll(io.LimitReader(resp.Body, int64(m.config.MaxBodySize)+1))
+	if err != nil {
+		return nil, err
+	}
+	return &result{
+		status:    resp.StatusCode,
+		header:    resp.Header,
+		body:      read[:min(len(read), m.config.MaxBodySize)],
+		truncated: len(read) > m.config.MaxBodySize,
+	}, nil
+}
+
+// compare returns the differences between both responses
+func (m *mirror) compare(primary, shadow *result) []string {
+	var diffs []string
+
+	if primary.status != shadow.status {
+		diffs = append(diffs, fmt.Sprintf("status %d != %d", primary.status, shadow.status))
+	}
+
+	for _, name := range m.config.CompareHeaders {
+		if p, s := primary.header.Get(name), shadow.header.Get(name); p != s {
+			diffs = append(diffs, fmt.Sprintf("header %s %q != %q", name, p, s))
+		}
+	}
+
+	if primary.truncated || shadow.truncated {
+		return diffs
+	}
+	if !equalBody(primary.body, shadow.body, primary.header.Get("Content-Type")) {
+		diffs = append(diffs, fmt.Sprintf("body %d bytes != %d bytes", len(primary.body), len(shadow.body)))
+	}
+	return diffs
+}
+
+// equalBody compares JSON bodies semantically, so key order and
+// whitespace don't count as differences
+func equalBody(a, b []byte, contentType string) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	if !strings.Contains(contentType, "json") {
+		return false
+	}
+
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// recorder is the response writer of the shadow handler
+type recorder struct {
+	header    http.Header
+	status    int
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *recorder) Write(data []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+
+	captured := data
+	if remaining := rec.limit - rec.buf.Len(); remaining < len(captured) {
+		rec.truncated = true
+		captured = captured[:max(remaining, 0)]
+	}
+	rec.buf.Write(captured)
+
+	return len(data), nil
+}
@@ -0,0 +1,192 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// recordHandler passes log records to a channel
+type recordHandler struct {
+	records chan slog.Record
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.records <- r
+	return nil
+}
+func (h recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h recordHandler) WithGroup(string) slog.Handler      { return h }
+
+func attrs(r slog.Record) map[string]string {
+	m := make(map[string]string)
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value.String()
+		return true
+	})
+	return m
+}
+
+func waitRecord(t *testing.T, records chan slog.Record) slog.Record {
+	t.Helper()
+	select {
+	case r := <-records:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("no mirror log record")
+	}
+	return slog.Record{}
+}
+
+func primary(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"echo":"` + string(body) + `","n":1}`))
+}
+
+func TestMirror(t *testing.T) {
+	tests := []struct {
+		name     string
+		shadow   http.HandlerFunc
+		wantMsg  string
+		wantDiff string
+	}{
+		{
+			name: "match ignores JSON key order",
+			shadow: func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{ "n": 1, "echo": "` + string(body) + `" }`))
+			},
+			wantMsg: "mirror match",
+		},
+		{
+			name: "status mismatch",
+			shadow: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantMsg:  "mirror mismatch",
+			wantDiff: "status 200 != 500",
+		},
+		{
+			name: "shadow panic",
+			shadow: func(w http.ResponseWriter, r *http.Request) {
+				panic("rewrite broken")
+			},
+			wantMsg: "mirror shadow panicked",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := make(chan slog.Record, 4)
+			mw := middleware.New(slog.New(recordHandler{records: records}))
+
+			config := DefaultConfig()
+			config.SampleRate = 1
+			config.Target = tt.shadow
+			handler := New(mw, config)(http.HandlerFunc(primary))
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("hello"))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.TraceIDKey, "trace-1"))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			// The primary response is untouched
+			if rec.Code != http.StatusOK || rec.Body.String() != `{"echo":"hello","n":1}` {
+				t.Fatalf("primary = %d %q", rec.Code, rec.Body)
+			}
+
+			r := waitRecord(t, records)
+			if r.Message != tt.wantMsg {
+				t.Fatalf("message = %q, want %q", r.Message, tt.wantMsg)
+			}
+			got := attrs(r)
+			if got["trace_id"] != "trace-1" {
+				t.Errorf("trace_id = %q, want trace-1", got["trace_id"])
+			}
+			if tt.wantDiff != "" && !strings.Contains(got["diff"], tt.wantDiff) {
+				t.Errorf("diff = %q, want %q", got["diff"], tt.wantDiff)
+			}
+		})
+	}
+}
+
+func TestMirrorURL(t *testing.T) {
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(Header) != "1" || r.Header.Get("X-Trace-Id") != "trace-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		primary(w, r)
+	}))
+	defer shadow.Close()
+
+	records := make(chan slog.Record, 4)
+	mw := middleware.New(slog.New(recordHandler{records: records}))
+
+	config := DefaultConfig()
+	config.SampleRate = 1
+	config.URL = shadow.URL
+	handler := New(mw, config)(http.HandlerFunc(primary))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader("hello"))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.TraceIDKey, "trace-1"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if r := waitRecord(t, records); r.Message != "mirror match" {
+		t.Errorf("message = %q, diff = %q", r.Message, attrs(r)["diff"])
+	}
+}
+
+func TestMirrorSkipsLargeBodies(t *testing.T) {
+	records := make(chan slog.Record, 4)
+	mw := middleware.New(slog.New(recordHandler{records: records}))
+
+	config := DefaultConfig()
+	config.SampleRate = 1
+	config.MaxBodySize = 4
+	config.Target = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("shadow called for a body above MaxBodySize")
+	})
+	handler := New(mw, config)(http.HandlerFunc(primary))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+
+	// The primary still reads the whole body
+	if !strings.Contains(rec.Body.String(), `"echo":"hello"`) {
+		t.Errorf("primary body = %q", rec.Body)
+	}
+	select {
+	case r := <-records:
+		t.Errorf("unexpected log %q", r.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorZeroConfig(t *testing.T) {
+	records := make(chan slog.Record, 4)
+	mw := middleware.New(slog.New(recordHandler{records: records}))
+
+	config := &Config{SampleRate: 1, Target: http.HandlerFunc(primary)}
+	handler := New(mw, config)(http.HandlerFunc(primary))
+
+	if config.Timeout <= 0 || config.MaxBodySize <= 0 || config.Client.Timeout != config.Timeout {
+		t.Fatalf("zero values not defaulted: %+v", config)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+
+	if r := waitRecord(t, records); r.Message != "mirror match" {
+		t.Errorf("message = %q, diff = %q", r.Message, attrs(r)["diff"])
+	}
+}
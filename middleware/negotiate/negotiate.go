@@ -0,0 +1,244 @@
+// Package negotiate provides Accept header content negotiation
+//
+// The middleware picks the best media type a handler offers and stores it in
+// the request context under middleware.MediaTypeKey, so responders and error
+// paths like RecoverPanic can answer in that format. RecoverPanic sees the
+// type whether it runs outside or inside the middleware.
+package negotiate
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Config holds content negotiation configuration
+type Config struct {
+	// Media types the handler can produce in order of preference
+	Offers []string
+}
+
+// DefaultConfig offers JSON only
+func DefaultConfig() *Config {
+	return &Config{
+		Offers: []string{"application/json"},
+	}
+}
+
+// New creates content negotiation middleware with custom config.
+// Requests that accept none of the offers get 406 Not Acceptable.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept")
+
+			mediaType, ok := Negotiate(r.Header.Get("Accept"), config.Offers)
+			if !ok {
+				notAcceptable(mw, w, r, config.Offers)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithMediaType(r.Context(), mediaType)))
+		})
+	}
+}
+
+// Handler creates content negotiation middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+func notAcceptable(mw *middleware.Middleware, w http.ResponseWriter, r *http.Request, offers []string) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	mw.Logger().Info("not acceptable",
+		slog.String("trace_id", traceID),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("accept", r.Header.Get("Accept")),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotAcceptable)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":     "not acceptable",
+		"available": offers,
+		"trace_id":  traceID,
+	})
+}
+
+// ContextWithMediaType returns a copy of ctx carrying the negotiated media type
+func ContextWithMediaType(ctx context.Context, mediaType string) context.Context {
+	return middleware.ContextWithMediaType(ctx, mediaType)
+}
+
+// FromContext returns the negotiated media type, "" if none
+func FromContext(ctx context.Context) string {
+	mediaType, _ := ctx.Value(middleware.MediaTypeKey).(string)
+	return mediaType
+}
+
+// MediaRange is one entry of an Accept header
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Q       float64
+}
+
+// String formats the range without its q-value
+func (mr MediaRange) String() string {
+	s := mr.Type + "/" + mr.Subtype
+
+	keys := make([]string, 0, len(mr.Params))
+	for k := range mr.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s += ";" + k + "=" + mr.Params[k]
+	}
+	return s
+}
+
+// specificity ranks exact types above subtype wildcards above */*
+func (mr MediaRange) specificity() int {
+	switch {
+	case mr.Type == "*":
+		return 0
+	case mr.Subtype == "*":
+		return 1
+	}
+	return 2 + len(mr.Params)
+}
+
+// Matches reports whether the media type falls into the range
+func (mr MediaRange) Matches(mediaType string) bool {
+	offer, ok := parseMediaRange(mediaType)
+	if !ok {
+		return false
+	}
+	return mr.matches(offer)
+}
+
+func (mr MediaRange) matches(offer MediaRange) bool {
+	if mr.Type != "*" && mr.Type != offer.Type {
+		return false
+	}
+	if mr.Subtype != "*" && mr.Subtype != offer.Subtype {
+		return false
+	}
+	for k, v := range mr.Params {
+		if !strings.EqualFold(offer.Params[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAccept parses an Accept header. Ranges are sorted by q-value and then
+// by specificity, q=0 ranges are kept because they exclude media types.
+// Example: "application/json, text/*;q=0.5, */*;q=0.1"
+func ParseAccept(header string) []MediaRange {
+	var ranges []MediaRange
+
+	for part := range strings.SplitSeq(header, ",") {
+		if mr, ok := parseMediaRange(part); ok {
+			ranges = append(ranges, mr)
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Q != ranges[j].Q {
+			return ranges[i].Q > ranges[j].Q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+func parseMediaRange(s string) (MediaRange, bool) {
+	mediaType, params, _ := strings.Cut(s, ";")
+
+	typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+	if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+		return MediaRange{}, false
+	}
+
+	mr := MediaRange{Type: typ, Subtype: subtype, Q: 1}
+	for param := range strings.SplitSeq(params, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		// Parameters after q are accept extensions, not media type parameters
+		if key == "q" {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+			mr.Q = q
+			break
+		}
+
+		if mr.Params == nil {
+			mr.Params = make(map[string]string)
+		}
+		mr.Params[key] = value
+	}
+
+	return mr, true
+}
+
+// Negotiate returns the offer the Accept header prefers. Each offer gets the
+// q-value of the most specific range matching it, ties go to the earlier
+// offer. An empty Accept header accepts the first offer.
+func Negotiate(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := ParseAccept(accept)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		parsed, ok := parseMediaRange(offer)
+		if !ok {
+			continue
+		}
+
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			if s := mr.specificity(); s > specificity && mr.matches(parsed) {
+				q, specificity = mr.Q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, bestQ > 0
+}
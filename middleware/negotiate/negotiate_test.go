@@ -0,0 +1,93 @@
+package negotiate
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "text/plain", "text/html"}
+
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", "application/json", true},
+		{"*/*", "application/json", true},
+		{"text/plain", "text/plain", true},
+		{"text/*", "text/plain", true},
+		{"text/*, text/html", "text/plain", true},
+		{"text/*;q=0.5, text/html", "text/html", true},
+		{"application/json;q=0.2, text/plain;q=0.8", "text/plain", true},
+		{"*/*;q=0.1, application/json;q=0", "text/plain", true},
+		{"application/json;version=2", "", false},
+		{"image/png", "", false},
+		{"text/*;q=0", "", false},
+		{"APPLICATION/JSON", "application/json", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, ok := Negotiate(tt.accept, offers)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Negotiate(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/*;q=0.5, application/json;charset="utf-8";q=0.5;ext=1, */*;q=0.1, bogus`)
+
+	if len(ranges) != 3 {
+		t.Fatalf("Expected 3 ranges, got %d", len(ranges))
+	}
+	if got := ranges[0].String(); got != "application/json;charset=utf-8" {
+		t.Errorf("Expected most specific range first, got %q", got)
+	}
+	if ranges[2].Q != 0.1 {
+		t.Errorf("Expected q=0.1 last, got %v", ranges[2].Q)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	mw := middleware.New(slog.New(slog.DiscardHandler))
+	negotiated := New(mw, &Config{Offers: []string{"application/json", "text/plain"}})
+	panics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	// RecoverPanic must answer in the negotiated format on either side of negotiate
+	chains := map[string]http.Handler{
+		"recover inside":  negotiated(mw.RecoverPanic(panics)),
+		"recover outside": mw.Chain(mw.LogRequest, mw.RecoverPanic).Then(negotiated(panics)),
+	}
+
+	tests := []struct {
+		accept          string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"application/json", http.StatusInternalServerError, "application/json"},
+		{"text/plain", http.StatusInternalServerError, "text/plain; charset=utf-8"},
+		{"image/png", http.StatusNotAcceptable, "application/json"},
+	}
+
+	for name, h := range chains {
+		for _, tt := range tests {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("%s, Accept %s: expected %d %s, got %d %s", name, tt.accept, tt.wantStatus, tt.wantContentType, w.Code, w.Header().Get("Content-Type"))
+			}
+		}
+	}
+}
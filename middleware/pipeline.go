@@ -0,0 +1,430 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Predicate decides per request whether a pipeline stage runs
+type Predicate func(r *http.Request) bool
+
+// Timing selects how a pipeline reports per-stage durations
+type Timing int
+
+const (
+	// TimingOff disables stage timing (default)
+	TimingOff Timing = iota
+	// TimingHeader adds a Server-Timing header to every response.
+	// Durations are the time each stage spent before handing off to the
+	// next one, measured when the response header is written.
+	TimingHeader
+	// TimingLog writes one debug log entry per request with the full
+	// duration of every stage and whether it was skipped or short-circuited
+	TimingLog
+)
+
+// Stage is a single named middleware inside a Pipeline
+type Stage struct {
+	name   string
+	fn     MiddlewareFunc
+	when   []Predicate
+	unless []Predicate
+}
+
+// Name returns the stage name
+func (s *Stage) Name() string {
+	return s.name
+}
+
+// When runs the stage only if pred returns true
+// Multiple conditions must all be true
+func (s *Stage) When(pred Predicate) *Stage {
+	s.when = append(s.when, pred)
+	return s
+}
+
+// Unless skips the stage if pred returns true
+func (s *Stage) Unless(pred Predicate) *Stage {
+	s.unless = append(s.unless, pred)
+	return s
+}
+
+// Conditional reports whether the stage has When or Unless conditions
+func (s *Stage) Conditional() bool {
+	return len(s.when) > 0 || len(s.unless) > 0
+}
+
+func (s *Stage) enabled(r *http.Request) bool {
+	for _, pred := range s.when {
+		if !pred(r) {
+			return false
+		}
+	}
+	for _, pred := range s.unless {
+		if pred(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pipeline is a named, introspectable middleware chain.
+// Configure it fully before calling Then; it is not safe to modify afterwards.
+type Pipeline struct {
+	name   string
+	logger *slog.Logger
+	timing Timing
+	stages []*Stage
+}
+
+// Chain combines middlewares into a pipeline.
+// Stages are named after the middleware function, e.g. "LogRequest".
+// Example: mw.Chain(mw.LogRequest, mw.RecoverPanic).Then(handler)
+func (m *Middleware) Chain(middlewares ...MiddlewareFunc) *Pipeline {
+	p := &Pipeline{
+		name:   "chain",
+		logger: m.logger,
+		stages: make([]*Stage, 0, len(middlewares)),
+	}
+
+	for _, fn := range middlewares {
+		p.Use(funcName(fn), fn)
+	}
+
+	return p
+}
+
+// Named sets the pipeline name used in logs
+func (p *Pipeline) Named(name string) *Pipeline {
+	p.name = name
+	return p
+}
+
+// WithTiming enables per-stage timing
+func (p *Pipeline) WithTiming(timing Timing) *Pipeline {
+	p.timing = timing
+	return p
+}
+
+// Use appends a named stage and returns it for adding conditions
+// Example: p.Use("gzip", gzip.Handler(mw)).Unless(isStream)
+func (p *Pipeline) Use(name string, fn MiddlewareFunc) *Stage {
+	s := &Stage{name: name, fn: fn}
+	p.stages = append(p.stages, s)
+	return s
+}
+
+// Stage returns the first stage with the given name or nil
+func (p *Pipeline) Stage(name string) *Stage {
+	for _, s := range p.stages {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Name returns the pipeline name
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+// Stages returns the stage names in execution order
+func (p *Pipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.name
+	}
+	return names
+}
+
+// String describes the pipeline, e.g. "api: LogRequest -> gzip(conditional)"
+func (p *Pipeline) String() string {
+	parts := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		parts[i] = s.name
+		if s.Conditional() {
+			parts[i] += "(conditional)"
+		}
+	}
+	return p.name + ": " + strings.Join(parts, " -> ")
+}
+
+// Func returns the pipeline as a MiddlewareFunc so it can be nested
+func (p *Pipeline) Func() MiddlewareFunc {
+	return p.Then
+}
+
+// Then wraps handler with all stages.
+// Build chain from right to left
+func (p *Pipeline) Then(handler http.Handler) http.Handler {
+	timed := p.timing != TimingOff
+
+	next := handler
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		next = p.wrapStage(i, next, timed)
+	}
+
+	if !timed {
+		return next
+	}
+
+	return p.withRecorder(next)
+}
+
+func (p *Pipeline) wrapStage(i int, next http.Handler, timed bool) http.Handler {
+	s := p.stages[i]
+
+	// The stage only sees the marker, so we can tell if it called next
+	inner := next
+	if timed {
+		inner = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rec := recorderFromRequest(r); rec != nil {
+				rec.pass(i)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	wrapped := s.fn(inner)
+
+	if !s.Conditional() && !timed {
+		return wrapped
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recorderFromRequest(r)
+
+		if !s.enabled(r) {
+			if rec != nil {
+				rec.skip(i)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rec != nil {
+			rec.enter(i)
+			defer rec.exit(i)
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+}
+
+func (p *Pipeline) withRecorder(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newRecorder(len(p.stages))
+		ctx := contextWithRecorder(r.Context(), rec)
+		r = r.WithContext(ctx)
+
+		var tw *timingWriter
+		if p.timing == TimingHeader {
+			tw = &timingWriter{ResponseWriter: w, pipeline: p, rec: rec}
+			w = tw
+		}
+
+		next.ServeHTTP(w, r)
+
+		// Handlers that return without writing get the implicit 200,
+		// which is sent after this
+		if tw != nil && !tw.wroteHeader {
+			tw.wroteHeader = true
+			tw.Header().Add("Server-Timing", p.serverTiming(rec))
+		}
+
+		if p.timing == TimingLog {
+			p.logTiming(r, rec)
+		}
+	})
+}
+
+func (p *Pipeline) logTiming(r *http.Request, rec *recorder) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	attrs := make([]any, 0, len(p.stages)+3)
+	attrs = append(attrs,
+		slog.String("pipeline", p.name),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	)
+
+	for i, s := range p.stages {
+		st := rec.stages[i]
+		if st.entered.IsZero() && !st.skipped {
+			// Never reached, an earlier stage short-circuited
+			continue
+		}
+		var duration time.Duration
+		if !st.skipped && !st.exited.IsZero() {
+			duration = st.exited.Sub(st.entered)
+		}
+		attrs = append(attrs, slog.Group(s.name,
+			slog.Duration("duration", duration),
+			slog.Bool("skipped", st.skipped),
+			slog.Bool("short_circuit", !st.skipped && st.passed.IsZero()),
+		))
+	}
+
+	p.logger.Debug("pipeline", attrs...)
+}
+
+// serverTiming renders the Server-Timing header value at the time it is called
+func (p *Pipeline) serverTiming(rec *recorder) string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	now := time.Now()
+	metrics := make([]string, 0, len(p.stages)+1)
+	last := time.Time{}
+
+	for i, s := range p.stages {
+		st := rec.stages[i]
+		if st.skipped || st.entered.IsZero() {
+			continue
+		}
+		end := st.passed
+		if end.IsZero() {
+			end = now
+		}
+		metrics = append(metrics, formatMetric(s.name, end.Sub(st.entered)))
+		last = st.passed
+		if st.passed.IsZero() {
+			// This stage answered the request itself
+			return strings.Join(metrics, ", ")
+		}
+	}
+
+	if !last.IsZero() {
+		metrics = append(metrics, formatMetric("handler", now.Sub(last)))
+	}
+
+	return strings.Join(metrics, ", ")
+}
+
+var nonToken = regexp.MustCompile(`[^A-Za-z0-9!#$%&'*+.^_|~-]`)
+
+func formatMetric(name string, d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	return nonToken.ReplaceAllString(name, "_") + ";dur=" + strconv.FormatFloat(ms, 'f', 3, 64)
+}
+
+// funcName derives a readable stage name from a middleware function.
+// "middleware.(*Middleware).LogRequest-fm" becomes "LogRequest" and
+// "middleware/gzip.New.func1" becomes "gzip.New". Closures are named after
+// the function that created them.
+func funcName(fn MiddlewareFunc) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return "anonymous"
+	}
+
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	// Method values keep only the method name, whatever the receiver
+	if method, ok := strings.CutSuffix(name, "-fm"); ok {
+		return method[strings.LastIndex(method, ".")+1:]
+	}
+	for {
+		i := strings.LastIndex(name, ".func")
+		if i < 0 {
+			break
+		}
+		if _, err := strconv.Atoi(name[i+len(".func"):]); err != nil {
+			break
+		}
+		name = name[:i]
+	}
+
+	return name
+}
+
+const recorderKey contextKey = "pipeline_recorder"
+
+func contextWithRecorder(ctx context.Context, rec *recorder) context.Context {
+	return context.WithValue(ctx, recorderKey, rec)
+}
+
+func recorderFromRequest(r *http.Request) *recorder {
+	rec, _ := r.Context().Value(recorderKey).(*recorder)
+	return rec
+}
+
+// stageTiming holds the timestamps of one stage for one request
+type stageTiming struct {
+	entered time.Time
+	passed  time.Time
+	exited  time.Time
+	skipped bool
+}
+
+// recorder collects stage timestamps for a single request
+type recorder struct {
+	mu     sync.Mutex
+	stages []stageTiming
+}
+
+func newRecorder(n int) *recorder {
+	return &recorder{stages: make([]stageTiming, n)}
+}
+
+func (rec *recorder) enter(i int) {
+	rec.mu.Lock()
+	rec.stages[i].entered = time.Now()
+	rec.mu.Unlock()
+}
+
+func (rec *recorder) pass(i int) {
+	rec.mu.Lock()
+	rec.stages[i].passed = time.Now()
+	rec.mu.Unlock()
+}
+
+func (rec *recorder) exit(i int) {
+	rec.mu.Lock()
+	rec.stages[i].exited = time.Now()
+	rec.mu.Unlock()
+}
+
+func (rec *recorder) skip(i int) {
+	rec.mu.Lock()
+	rec.stages[i].skipped = true
+	rec.mu.Unlock()
+}
+
+// timingWriter adds the Server-Timing header right before the header is sent
+type timingWriter struct {
+	http.ResponseWriter
+	pipeline    *Pipeline
+	rec         *recorder
+	wroteHeader bool
+}
+
+func (tw *timingWriter) WriteHeader(code int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Add("Server-Timing", tw.pipeline.serverTiming(tw.rec))
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingWriter) Write(data []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
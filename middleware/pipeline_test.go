@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// tag appends name to the X-Stages response header and calls next
+func tag(name string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Stages", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deny answers the request itself without calling next
+func deny(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("X-Stages", "handler")
+	w.Write([]byte("ok"))
+})
+
+func isAPI(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func TestPipelineStages(t *testing.T) {
+	mw := New(nil)
+	p := mw.Chain(mw.LogRequest, mw.RecoverPanic).Named("api")
+	p.Use("auth", tag("auth")).When(isAPI)
+
+	if got := strings.Join(p.Stages(), ","); got != "LogRequest,RecoverPanic,auth" {
+		t.Errorf("Stages() = %s", got)
+	}
+	if got := p.String(); got != "api: LogRequest -> RecoverPanic -> auth(conditional)" {
+		t.Errorf("String() = %q", got)
+	}
+	if p.Stage("auth") == nil || p.Stage("missing") != nil {
+		t.Error("Stage lookup by name failed")
+	}
+}
+
+func TestPipelineConditions(t *testing.T) {
+	mw := New(nil)
+	p := mw.Chain()
+	p.Use("api", tag("api")).When(isAPI)
+	p.Use("web", tag("web")).Unless(isAPI)
+	h := p.Then(okHandler)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/users", "api,handler"},
+		{"/index.html", "web,handler"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		// A skipped stage must still pass the request on
+		if got := strings.Join(rec.Header().Values("X-Stages"), ","); got != tt.want {
+			t.Errorf("%s: stages = %s, want %s", tt.path, got, tt.want)
+		}
+		if rec.Body.String() != "ok" {
+			t.Errorf("%s: handler not reached", tt.path)
+		}
+	}
+}
+
+func TestPipelineServerTiming(t *testing.T) {
+	mw := New(nil)
+	p := mw.Chain().WithTiming(TimingHeader)
+	p.Use("first stage", tag("first"))
+	p.Use("skipped", tag("skipped")).When(func(*http.Request) bool { return false })
+	h := p.Then(okHandler)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	got := rec.Header().Get("Server-Timing")
+	want := regexp.MustCompile(`^first_stage;dur=\d+\.\d{3}, handler;dur=\d+\.\d{3}$`)
+	if !want.MatchString(got) {
+		t.Errorf("Server-Timing = %q", got)
+	}
+
+	// A short-circuiting stage ends the header
+	p = mw.Chain().WithTiming(TimingHeader)
+	p.Use("deny", deny)
+	p.Use("after", tag("after"))
+	rec = httptest.NewRecorder()
+	p.Then(okHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("Server-Timing"); !regexp.MustCompile(`^deny;dur=\d+\.\d{3}$`).MatchString(got) {
+		t.Errorf("short-circuit Server-Timing = %q", got)
+	}
+}
+
+func TestPipelineServerTimingWithoutWrite(t *testing.T) {
+	mw := New(nil)
+	p := mw.Chain().WithTiming(TimingHeader)
+	p.Use("auth", tag("auth"))
+
+	rec := httptest.NewRecorder()
+	p.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	got := rec.Header().Get("Server-Timing")
+	if !regexp.MustCompile(`^auth;dur=\d+\.\d{3}, handler;dur=\d+\.\d{3}$`).MatchString(got) {
+		t.Errorf("Server-Timing = %q", got)
+	}
+}
+
+func TestPipelineTimingLog(t *testing.T) {
+	var logs bytes.Buffer
+	mw := New(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	p := mw.Chain().Named("admin").WithTiming(TimingLog)
+	p.Use("audit", tag("audit"))
+	p.Use("skipped", tag("skipped")).Unless(func(*http.Request) bool { return true })
+	p.Use("deny", deny)
+	p.Use("unreached", tag("unreached"))
+
+	rec := httptest.NewRecorder()
+	p.Then(okHandler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry: %v: %s", err, logs.String())
+	}
+	if entry["pipeline"] != "admin" {
+		t.Errorf("pipeline = %v", entry["pipeline"])
+	}
+
+	stage := func(name string) map[string]any {
+		s, _ := entry[name].(map[string]any)
+		return s
+	}
+	if s := stage("audit"); s == nil || s["short_circuit"] != false || s["skipped"] != false {
+		t.Errorf("audit = %v", s)
+	}
+	if s := stage("skipped"); s == nil || s["skipped"] != true {
+		t.Errorf("skipped = %v", s)
+	}
+	if s := stage("deny"); s == nil || s["short_circuit"] != true {
+		t.Errorf("deny = %v", s)
+	}
+	if s := stage("unreached"); s != nil {
+		t.Errorf("unreached stage logged: %v", s)
+	}
+}
+
+type named struct{}
+
+func (named) Wrap(next http.Handler) http.Handler { return next }
+
+func TestFuncName(t *testing.T) {
+	mw := New(nil)
+	closure := func(next http.Handler) http.Handler { return next }
+
+	tests := []struct {
+		name string
+		fn   MiddlewareFunc
+		want string
+	}{
+		{"method value", mw.LogRequest, "LogRequest"},
+		{"value receiver", named{}.Wrap, "Wrap"},
+		{"returned closure", tag("x"), "middleware.tag"},
+		{"function", deny, "middleware.deny"},
+		{"local closure", closure, "middleware.TestFuncName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := funcName(tt.fn); got != tt.want {
+				t.Errorf("funcName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
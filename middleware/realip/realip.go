@@ -0,0 +1,178 @@
+// Package realip resolves the client IP behind trusted reverse proxies
+package realip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+type contextKey struct{}
+
+// Config holds real IP configuration
+type Config struct {
+	// CIDRs of proxies whose forwarding headers are trusted
+	TrustedProxies []string
+	// Headers checked in order, X-Forwarded-For style lists are supported
+	Headers []string
+}
+
+// DefaultConfig trusts loopback and private networks
+func DefaultConfig() *Config {
+	return &Config{
+		TrustedProxies: []string{
+			"127.0.0.0/8",
+			"10.0.0.0/8",
+			"172.16.0.0/12",
+			"192.168.0.0/16",
+			"::1/128",
+			"fc00::/7",
+		},
+		Headers: []string{"X-Forwarded-For", "X-Real-Ip"},
+	}
+}
+
+// Resolver resolves client IPs for a fixed set of trusted proxies
+type Resolver struct {
+	trusted []netip.Prefix
+	headers []string
+}
+
+// NewResolver parses the trusted proxy CIDRs
+func NewResolver(config *Config) (*Resolver, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	trusted, err := ParsePrefixes(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resolver{trusted: trusted, headers: config.Headers}, nil
+}
+
+// Trusted reports whether addr is a trusted proxy
+func (res *Resolver) Trusted(addr netip.Addr) bool {
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP of r.
+// Forwarding headers are only used if the direct peer is a trusted proxy,
+// and the rightmost untrusted address wins so clients can't spoof it.
+func (res *Resolver) Resolve(r *http.Request) netip.Addr {
+	peer := RemoteAddr(r)
+	if !peer.IsValid() || !res.Trusted(peer) {
+		return peer
+	}
+
+	for _, header := range res.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			addr = addr.Unmap()
+			if !res.Trusted(addr) || i == 0 {
+				return addr
+			}
+		}
+	}
+
+	return peer
+}
+
+// New creates middleware that stores the resolved client IP in the context.
+// It panics if a trusted proxy CIDR is invalid.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	res, err := NewResolver(config)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if addr := res.Resolve(r); addr.IsValid() {
+				r = r.WithContext(context.WithValue(r.Context(), contextKey{}, addr))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Handler creates real IP middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+// FromContext returns the IP stored by the middleware
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(contextKey{}).(netip.Addr)
+	return addr, ok
+}
+
+// FromRequest returns the resolved client IP, falling back to RemoteAddr
+func FromRequest(r *http.Request) netip.Addr {
+	if addr, ok := FromContext(r.Context()); ok {
+		return addr
+	}
+	return RemoteAddr(r)
+}
+
+// RemoteAddr parses the IP of the direct peer
+func RemoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// ParsePrefixes parses CIDRs, single addresses are treated as /32 or /128
+func ParsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if p.Addr().Is4In6() {
+			p = netip.PrefixFrom(p.Addr().Unmap(), max(p.Bits()-96, 0))
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+
+	return prefixes, nil
+}
@@ -0,0 +1,145 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestResolve(t *testing.T) {
+	res, err := NewResolver(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		peer   string
+		header http.Header
+		want   string
+	}{
+		{
+			name: "untrusted peer ignores headers",
+			peer: "203.0.113.9:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name: "rightmost untrusted wins",
+			peer: "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.2"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "multiple header lines",
+			peer: "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"1.1.1.1", "198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "all hops trusted",
+			peer: "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"192.168.1.5, 10.0.0.2"},
+			},
+			want: "192.168.1.5",
+		},
+		{
+			// A spoofed hop left of garbage must not be used
+			name: "break on bad hop",
+			peer: "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"198.51.100.1, not-an-ip, 10.0.0.2"},
+			},
+			want: "10.0.0.1",
+		},
+		{
+			name: "bad hop falls through to next header",
+			peer: "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"garbage"},
+				"X-Real-Ip":       {"198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "ipv4-mapped hop",
+			peer: "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"::ffff:198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "ipv4-mapped trusted peer",
+			peer: "[::ffff:10.0.0.1]:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "ipv6",
+			peer: "[::1]:1234",
+			header: http.Header{
+				"X-Forwarded-For": {"2001:db8::1, fd00::1"},
+			},
+			want: "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.peer
+			r.Header = tt.header
+
+			if got := res.Resolve(r); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("Resolve() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.0.0.0/8", "192.0.2.1", "::ffff:172.16.0.0/108"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "172.16.0.0/12"}
+	for i, p := range prefixes {
+		if p.String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, p, want[i])
+		}
+	}
+
+	if _, err := ParsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var got netip.Addr
+	h := Handler(middleware.New(nil))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got != netip.MustParseAddr("198.51.100.1") {
+		t.Errorf("FromRequest() = %s", got)
+	}
+}
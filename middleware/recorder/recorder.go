@@ -0,0 +1,184 @@
+// Package recorder provides middleware that records sampled traffic as JSON Lines
+//
+// Recordings can be replayed with the replay package for regression tests
+// or to reproduce production bugs locally.
+package recorder
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Redacted replaces sensitive values in recordings
+const Redacted = "[REDACTED]"
+
+// Config holds recorder configuration
+type Config struct {
+	// Fraction of requests to record (0.0 to 1.0)
+	SampleRate float64
+	// Maximum bytes recorded per request and response body
+	MaxBodySize int
+	// Destination of the JSON Lines, e.g. a *rotate.Writer
+	Output io.Writer
+	// Hooks run on every exchange before it is written, e.g. RedactHeaders
+	Redact []func(*Exchange)
+}
+
+// DefaultConfig records 1% of requests and redacts credentials
+func DefaultConfig() *Config {
+	return &Config{
+		SampleRate:  0.01,
+		MaxBodySize: 64 << 10, // 64KB
+		Output:      os.Stdout,
+		Redact: []func(*Exchange){
+			RedactHeaders("Authorization", "Cookie", "Set-Cookie", "X-Api-Key"),
+		},
+	}
+}
+
+// Exchange is one recorded request and response
+type Exchange struct {
+	Time     time.Time     `json:"time"`
+	TraceID  string        `json:"trace_id,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Request  Request       `json:"request"`
+	Response Response      `json:"response"`
+}
+
+// Request is the recorded request
+type Request struct {
+	Method    string      `json:"method"`
+	URL       string      `json:"url"` // path and query
+	Host      string      `json:"host"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// Response is the recorded response
+type Response struct {
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// New creates recorder middleware with custom config
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultConfig().MaxBodySize
+	}
+
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) || rand.Float64() >= config.SampleRate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ex := &Exchange{
+				Time: time.Now(),
+				Request: Request{
+					Method: r.Method,
+					URL:    r.URL.RequestURI(),
+					Host:   r.Host,
+					Header: r.Header.Clone(),
+				},
+			}
+
+			// Read the body up front so the recording has it even if the
+			// handler doesn't read it completely
+			body, truncated, err := middleware.PeekBody(r, config.MaxBodySize)
+			if err != nil {
+				mw.Logger().Error("recorder failed to read body", slog.String("error", err.Error()))
+			}
+			ex.Request.Body = body
+			ex.Request.Truncated = truncated
+
+			wrapped := middleware.NewCaptureWriter(w, config.MaxBodySize)
+
+			next.ServeHTTP(wrapped, r)
+
+			ex.Duration = time.Since(ex.Time)
+			ex.TraceID = middleware.GetTraceIDFromContext(r.Context())
+			ex.Response = Response{
+				Status:    wrapped.StatusCode(),
+				Header:    w.Header().Clone(),
+				Body:      wrapped.Body(),
+				Truncated: wrapped.Truncated(),
+			}
+
+			for _, redact := range config.Redact {
+				redact(ex)
+			}
+
+			line, err := json.Marshal(ex)
+			if err != nil {
+				mw.Logger().Error("recorder failed to encode exchange", slog.String("error", err.Error()))
+				return
+			}
+			line = append(line, '\n')
+
+			mu.Lock()
+			config.Output.Write(line)
+			mu.Unlock()
+		})
+	}
+}
+
+// Handler creates recorder middleware with default config
+func Handler(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return New(mw, DefaultConfig())
+}
+
+// RedactHeaders replaces the given request and response headers
+func RedactHeaders(names ...string) func(*Exchange) {
+	return func(ex *Exchange) {
+		for _, name := range names {
+			for _, h := range []http.Header{ex.Request.Header, ex.Response.Header} {
+				if h.Get(name) != "" {
+					h.Set(name, Redacted)
+				}
+			}
+		}
+	}
+}
+
+// RedactQuery replaces the given query parameters in the request URL
+func RedactQuery(names ...string) func(*Exchange) {
+	return func(ex *Exchange) {
+		path, rawQuery, ok := strings.Cut(ex.Request.URL, "?")
+		if !ok {
+			return
+		}
+
+		params := strings.Split(rawQuery, "&")
+		for i, param := range params {
+			key, _, _ := strings.Cut(param, "=")
+			for _, name := range names {
+				if key == name {
+					params[i] = key + "=" + url.QueryEscape(Redacted)
+				}
+			}
+		}
+		ex.Request.URL = path + "?" + strings.Join(params, "&")
+	}
+}
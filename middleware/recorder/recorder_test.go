@@ -0,0 +1,81 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestRecord(t *testing.T) {
+	var out bytes.Buffer
+	config := DefaultConfig()
+	config.SampleRate = 1
+	config.MaxBodySize = 0 // defaulted
+	config.Output = &out
+	config.Redact = append(config.Redact, RedactQuery("token"))
+
+	var handlerBody string
+	h := New(middleware.New(nil), config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		handlerBody = string(body)
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("done"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/jobs?token=abc&page=2", strings.NewReader("payload"))
+	r.Header.Set("Authorization", "Bearer abc")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if handlerBody != "payload" {
+		t.Errorf("handler read %q, want the whole body", handlerBody)
+	}
+
+	var ex Exchange
+	if err := json.Unmarshal(out.Bytes(), &ex); err != nil {
+		t.Fatal(err)
+	}
+	if string(ex.Request.Body) != "payload" || ex.Request.Truncated {
+		t.Errorf("request body = %q, truncated = %v", ex.Request.Body, ex.Request.Truncated)
+	}
+	if ex.Response.Status != http.StatusAccepted || string(ex.Response.Body) != "done" {
+		t.Errorf("response = %d %q", ex.Response.Status, ex.Response.Body)
+	}
+	if ex.Request.URL != "/jobs?token=%5BREDACTED%5D&page=2" {
+		t.Errorf("url = %q", ex.Request.URL)
+	}
+	if ex.Request.Header.Get("Authorization") != Redacted || ex.Response.Header.Get("Set-Cookie") != Redacted {
+		t.Errorf("headers not redacted: %v %v", ex.Request.Header, ex.Response.Header)
+	}
+}
+
+func TestRecordTruncated(t *testing.T) {
+	var out bytes.Buffer
+	h := New(middleware.New(nil), &Config{SampleRate: 1, MaxBodySize: 4, Output: &out})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("echo me")))
+
+	if rec.Body.String() != "echo me" {
+		t.Errorf("handler saw %q", rec.Body.String())
+	}
+
+	var ex Exchange
+	if err := json.Unmarshal(out.Bytes(), &ex); err != nil {
+		t.Fatal(err)
+	}
+	if string(ex.Request.Body) != "echo" || !ex.Request.Truncated {
+		t.Errorf("request body = %q, truncated = %v", ex.Request.Body, ex.Request.Truncated)
+	}
+	if string(ex.Response.Body) != "echo" || !ex.Response.Truncated {
+		t.Errorf("response body = %q, truncated = %v", ex.Response.Body, ex.Response.Truncated)
+	}
+}
@@ -0,0 +1,53 @@
+package signature
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceCache remembers nonces until they expire. Use a shared
+// implementation, e.g. backed by Redis, when running several instances.
+type NonceCache interface {
+	// Seen records nonce and reports whether it was recorded before
+	Seen(nonce string, expires time.Time) bool
+}
+
+// MemoryNonceCache is an in-memory NonceCache
+type MemoryNonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	swept  time.Time
+	now    func() time.Time
+}
+
+// NewMemoryNonceCache creates an empty cache
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// Seen records nonce and reports whether it is still remembered
+func (c *MemoryNonceCache) Seen(nonce string, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	// Drop expired nonces at most once per second
+	if now.Sub(c.swept) > time.Second {
+		for n, exp := range c.nonces {
+			if now.After(exp) {
+				delete(c.nonces, n)
+			}
+		}
+		c.swept = now
+	}
+
+	if exp, ok := c.nonces[nonce]; ok && !now.After(exp) {
+		return true
+	}
+	c.nonces[nonce] = expires
+	return false
+}
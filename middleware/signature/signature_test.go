@@ -0,0 +1,166 @@
+package signature
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	oldSecret, newSecret := []byte("old"), []byte("new")
+
+	var got string
+	h := New(middleware.New(nil), &Config{
+		Secrets:     [][]byte{newSecret, oldSecret},
+		Tolerance:   time.Minute,
+		MaxBodySize: 1024,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+	}))
+
+	signed := func(secret []byte, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/orders?source=shop", strings.NewReader(body))
+		if err := NewSigner(secret).Sign(r); err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		return r
+	}
+
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		for _, secret := range [][]byte{newSecret, oldSecret} {
+			if code := serve(signed(secret, `{"id":1}`)); code != http.StatusOK {
+				t.Errorf("Expected 200, got %d", code)
+			}
+			if got != `{"id":1}` {
+				t.Errorf("Expected body to reach handler, got %q", got)
+			}
+		}
+	})
+
+	t.Run("unknown secret", func(t *testing.T) {
+		if code := serve(signed([]byte("other"), "{}")); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		r := signed(newSecret, `{"amount":1}`)
+		r.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+		if code := serve(r); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+	})
+
+	t.Run("tampered query", func(t *testing.T) {
+		r := signed(newSecret, "{}")
+		r.URL.RawQuery = "source=evil"
+		r.RequestURI = "/webhooks/orders?source=evil"
+		if code := serve(r); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		r := signed(newSecret, "{}")
+		replay := r.Clone(r.Context())
+		replay.Body = io.NopCloser(strings.NewReader("{}"))
+
+		if code := serve(r); code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if code := serve(replay); code != http.StatusUnauthorized {
+			t.Errorf("Expected replay to be rejected, got %d", code)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		s := NewSigner(newSecret)
+		s.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		s.Sign(r)
+		if code := serve(r); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if code := serve(httptest.NewRequest(http.MethodPost, "/", nil)); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		if code := serve(signed(newSecret, strings.Repeat("a", 2048))); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413, got %d", code)
+		}
+	})
+}
+
+func TestRoundTripper(t *testing.T) {
+	secret := []byte("secret")
+
+	srv := httptest.NewServer(New(middleware.New(nil), &Config{Secrets: [][]byte{secret}, Tolerance: time.Minute, MaxBodySize: 1024})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	))
+	defer srv.Close()
+
+	c := &http.Client{Transport: NewSigner(secret).RoundTripper(nil)}
+	resp, err := c.Post(srv.URL+"/hook?a=1", "application/json", strings.NewReader(`{"ok":true}`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestZeroConfigDefaults(t *testing.T) {
+	secret := []byte("secret")
+	h := New(middleware.New(nil), &Config{Secrets: [][]byte{secret}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"id":1}`))
+	if err := NewSigner(secret).Sign(r); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with zero MaxBodySize and Tolerance, got %d", w.Code)
+	}
+}
+
+func TestVerifyBehindStripPrefix(t *testing.T) {
+	secret := []byte("secret")
+	h := http.StripPrefix("/api", New(middleware.New(nil), &Config{Secrets: [][]byte{secret}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/webhooks?source=shop", strings.NewReader(`{"id":1}`))
+	if err := NewSigner(secret).Sign(r); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with the prefix stripped, got %d", w.Code)
+	}
+}
@@ -0,0 +1,149 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Config holds verification configuration
+type Config struct {
+	// Active secrets, a signature made with any of them is accepted
+	Secrets [][]byte
+	// Maximum difference between the signature timestamp and now
+	Tolerance time.Duration
+	// Maximum body size in bytes that is read for verification
+	MaxBodySize int64
+	// Remembers nonces to block replays (default: in-memory cache)
+	Nonces NonceCache
+}
+
+// DefaultConfig returns sensible defaults, Secrets must still be set
+func DefaultConfig() *Config {
+	return &Config{
+		Tolerance:   5 * time.Minute,
+		MaxBodySize: 1 << 20, // 1MB
+	}
+}
+
+// New creates signature verification middleware with custom config.
+// It panics if no secret is configured.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if len(config.Secrets) == 0 {
+		panic("signature: Config.Secrets is required")
+	}
+	if config.Nonces == nil {
+		config.Nonces = NewMemoryNonceCache()
+	}
+	if config.Tolerance <= 0 {
+		config.Tolerance = DefaultConfig().Tolerance
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultConfig().MaxBodySize
+	}
+
+	v := &verifier{config: config, now: time.Now}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.MaxBodySize))
+			r.Body.Close()
+			if err == nil {
+				err = v.verify(r, body)
+			}
+			if err != nil {
+				reject(mw, w, r, err)
+				return
+			}
+
+			// Handlers read the body as if it was never touched
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type verifier struct {
+	config *Config
+	now    func() time.Time
+}
+
+func (v *verifier) verify(r *http.Request, body []byte) error {
+	signature := r.Header.Get(SignatureHeader)
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	if signature == "" || timestamp == "" || nonce == "" {
+		return ErrMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestamp
+	}
+	signedAt := time.Unix(seconds, 0)
+	now := v.now()
+	if signedAt.Before(now.Add(-v.config.Tolerance)) || signedAt.After(now.Add(v.config.Tolerance)) {
+		return ErrTimestamp
+	}
+
+	canonical := Canonical(r.Method, requestURI(r), timestamp, nonce, body)
+	if !verify(v.config.Secrets, canonical, signature) {
+		return ErrInvalid
+	}
+
+	// Only valid signatures use up a nonce, so nobody can block one.
+	// Older nonces are rejected by the timestamp check.
+	if v.config.Nonces.Seen(nonce, signedAt.Add(v.config.Tolerance)) {
+		return ErrReplay
+	}
+
+	return nil
+}
+
+// requestURI returns the target the client signed. r.RequestURI is the raw
+// request line, which http.StripPrefix and routers leave intact.
+func requestURI(r *http.Request) string {
+	if r.RequestURI != "" {
+		return r.RequestURI
+	}
+	return r.URL.RequestURI()
+}
+
+func reject(mw *middleware.Middleware, w http.ResponseWriter, r *http.Request, err error) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	mw.Logger().Warn("signature rejected",
+		slog.String("trace_id", traceID),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("error", err.Error()),
+	)
+
+	status, message := http.StatusUnauthorized, "invalid signature"
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		status, message = http.StatusRequestEntityTooLarge, "request body too large"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    message,
+		"trace_id": traceID,
+	})
+}
@@ -0,0 +1,383 @@
+// Package slo provides per-route latency histograms and SLO error-budget tracking
+//
+// The tracker keeps rolling counters per route and reports how fast each
+// route burns its error budget. A burn rate of 1 uses the budget up exactly
+// by the end of the SLO period, higher values use it up faster.
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// UnmatchedRoute is used for requests without r.Pattern
+const UnmatchedRoute = "unmatched"
+
+// Objective is the service level objective of a route
+type Objective struct {
+	// Target ratio of successful requests, e.g. 0.999
+	Availability float64
+	// Requests slower than Latency violate the latency objective
+	Latency time.Duration
+	// Target ratio of requests faster than Latency, e.g. 0.99
+	LatencyTarget float64
+}
+
+// Config holds SLO tracker configuration
+type Config struct {
+	// Objective for routes without an entry in Routes
+	Objective Objective
+	// Per route objectives keyed by r.Pattern, e.g. "GET /users/{id}"
+	Routes map[string]Objective
+	// Rolling windows to report, e.g. 5m, 1h and 6h
+	Windows []time.Duration
+	// Granularity of the rolling windows
+	Resolution time.Duration
+	// Upper bounds of the latency histogram buckets
+	Buckets []time.Duration
+	// OnBurn is called when a burn rate exceeds BurnRateThreshold.
+	// It runs at most once per route, window and Resolution.
+	OnBurn            func(Alert)
+	BurnRateThreshold float64
+	// IsError classifies responses as failed (default: status >= 500)
+	IsError func(status int) bool
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Objective: Objective{
+			Availability:  0.999,
+			Latency:       300 * time.Millisecond,
+			LatencyTarget: 0.99,
+		},
+		Windows:    []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour},
+		Resolution: 10 * time.Second,
+		Buckets: []time.Duration{
+			5 * time.Millisecond,
+			10 * time.Millisecond,
+			25 * time.Millisecond,
+			50 * time.Millisecond,
+			100 * time.Millisecond,
+			250 * time.Millisecond,
+			500 * time.Millisecond,
+			time.Second,
+			2500 * time.Millisecond,
+			5 * time.Second,
+			10 * time.Second,
+		},
+		// Google SRE workbook: 2% of a 30 day budget in one hour
+		BurnRateThreshold: 14.4,
+		IsError: func(status int) bool {
+			return status >= http.StatusInternalServerError
+		},
+	}
+}
+
+// Alert describes a burn rate above the threshold
+type Alert struct {
+	Route     string        `json:"route"`
+	Window    time.Duration `json:"window"`
+	Objective string        `json:"objective"` // "availability" or "latency"
+	BurnRate  float64       `json:"burn_rate"`
+	Threshold float64       `json:"threshold"`
+}
+
+// Tracker records requests and computes SLO compliance
+type Tracker struct {
+	mw     *middleware.Middleware
+	config *Config
+	slots  int
+	now    func() time.Time
+
+	mu     sync.RWMutex
+	routes map[string]*route
+}
+
+// New creates a tracker. Use Tracker.Handler as middleware.
+// Place it right around the router so r.Pattern is set when it returns.
+func New(mw *middleware.Middleware, config *Config) *Tracker {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	defaults := DefaultConfig()
+	if config.Resolution <= 0 {
+		config.Resolution = defaults.Resolution
+	}
+	if len(config.Windows) == 0 {
+		config.Windows = defaults.Windows
+	}
+	if config.IsError == nil {
+		config.IsError = defaults.IsError
+	}
+	slices.Sort(config.Buckets)
+
+	longest := slices.Max(config.Windows)
+
+	return &Tracker{
+		mw:     mw,
+		config: config,
+		slots:  int(longest/config.Resolution) + 1,
+		now:    time.Now,
+		routes: make(map[string]*route),
+	}
+}
+
+// Handler records every request, use it as middleware.MiddlewareFunc
+func (t *Tracker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.mw.ShouldSkip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		wrapped := middleware.NewResponseWriter(w)
+
+		next.ServeHTTP(wrapped, r)
+
+		name := r.Pattern
+		if name == "" {
+			name = UnmatchedRoute
+		}
+		t.Record(name, wrapped.StatusCode(), time.Since(start))
+	})
+}
+
+// Record adds a single request outcome to a route
+func (t *Tracker) Record(name string, status int, duration time.Duration) {
+	rt := t.route(name)
+	objective := rt.objective
+
+	failed := t.config.IsError(status)
+	slow := objective.Latency > 0 && duration > objective.Latency
+
+	alerts := rt.record(t, t.now(), failed, slow, duration)
+	for _, alert := range alerts {
+		t.config.OnBurn(alert)
+	}
+}
+
+func (t *Tracker) route(name string) *route {
+	t.mu.RLock()
+	rt, ok := t.routes[name]
+	t.mu.RUnlock()
+	if ok {
+		return rt
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rt, ok := t.routes[name]; ok {
+		return rt
+	}
+
+	objective, ok := t.config.Routes[name]
+	if !ok {
+		objective = t.config.Objective
+	}
+
+	rt = &route{
+		name:      name,
+		objective: objective,
+		slots:     make([]slot, t.slots),
+		buckets:   make([]int64, len(t.config.Buckets)+1),
+	}
+	t.routes[name] = rt
+	return rt
+}
+
+// RouteStatus is the current state of one route
+type RouteStatus struct {
+	Route     string          `json:"route"`
+	Objective ObjectiveStatus `json:"objective"`
+	Windows   []WindowStatus  `json:"windows"`
+	Histogram []Bucket        `json:"histogram"`
+}
+
+// ObjectiveStatus is Objective in JSON friendly units
+type ObjectiveStatus struct {
+	Availability  float64 `json:"availability"`
+	LatencyMS     float64 `json:"latency_ms"`
+	LatencyTarget float64 `json:"latency_target"`
+}
+
+// WindowStatus holds the compliance over one rolling window
+type WindowStatus struct {
+	Window               string  `json:"window"`
+	Requests             int64   `json:"requests"`
+	Errors               int64   `json:"errors"`
+	Slow                 int64   `json:"slow"`
+	SuccessRatio         float64 `json:"success_ratio"`
+	LatencyRatio         float64 `json:"latency_ratio"`
+	AvailabilityBurnRate float64 `json:"availability_burn_rate"`
+	LatencyBurnRate      float64 `json:"latency_burn_rate"`
+}
+
+// Bucket is a cumulative histogram bucket, LEMS is -1 for +Inf
+type Bucket struct {
+	LEMS  float64 `json:"le_ms"`
+	Count int64   `json:"count"`
+}
+
+// Status returns the state of all routes sorted by route
+func (t *Tracker) Status() []RouteStatus {
+	t.mu.RLock()
+	routes := make([]*route, 0, len(t.routes))
+	for _, rt := range t.routes {
+		routes = append(routes, rt)
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].name < routes[j].name })
+
+	now := t.now()
+	status := make([]RouteStatus, 0, len(routes))
+	for _, rt := range routes {
+		status = append(status, rt.status(t, now))
+	}
+	return status
+}
+
+// StatusHandler serves Status as JSON
+func (t *Tracker) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]any{"routes": t.Status()})
+	})
+}
+
+// slot counts requests during one Resolution interval
+type slot struct {
+	epoch    int64
+	requests int64
+	errors   int64
+	slow     int64
+}
+
+type route struct {
+	name      string
+	objective Objective
+
+	mu      sync.Mutex
+	slots   []slot
+	buckets []int64
+	// epoch of the last burn rate evaluation
+	evaluated int64
+}
+
+func (rt *route) record(t *Tracker, now time.Time, failed, slow bool, duration time.Duration) []Alert {
+	epoch := now.UnixNano() / int64(t.config.Resolution)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	s := &rt.slots[epoch%int64(len(rt.slots))]
+	if s.epoch != epoch {
+		*s = slot{epoch: epoch}
+	}
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	if slow {
+		s.slow++
+	}
+
+	i, _ := slices.BinarySearch(t.config.Buckets, duration)
+	rt.buckets[i]++
+
+	if t.config.OnBurn == nil || t.config.BurnRateThreshold <= 0 || rt.evaluated == epoch {
+		return nil
+	}
+	rt.evaluated = epoch
+
+	var alerts []Alert
+	for _, window := range t.config.Windows {
+		ws := rt.window(t, epoch, window)
+		if ws.AvailabilityBurnRate > t.config.BurnRateThreshold {
+			alerts = append(alerts, Alert{rt.name, window, "availability", ws.AvailabilityBurnRate, t.config.BurnRateThreshold})
+		}
+		if ws.LatencyBurnRate > t.config.BurnRateThreshold {
+			alerts = append(alerts, Alert{rt.name, window, "latency", ws.LatencyBurnRate, t.config.BurnRateThreshold})
+		}
+	}
+	return alerts
+}
+
+func (rt *route) status(t *Tracker, now time.Time) RouteStatus {
+	epoch := now.UnixNano() / int64(t.config.Resolution)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	status := RouteStatus{
+		Route: rt.name,
+		Objective: ObjectiveStatus{
+			Availability:  rt.objective.Availability,
+			LatencyMS:     float64(rt.objective.Latency) / float64(time.Millisecond),
+			LatencyTarget: rt.objective.LatencyTarget,
+		},
+		Windows:   make([]WindowStatus, 0, len(t.config.Windows)),
+		Histogram: make([]Bucket, 0, len(rt.buckets)),
+	}
+
+	for _, window := range t.config.Windows {
+		status.Windows = append(status.Windows, rt.window(t, epoch, window))
+	}
+
+	var cumulative int64
+	for i, count := range rt.buckets {
+		cumulative += count
+		le := -1.0
+		if i < len(t.config.Buckets) {
+			le = float64(t.config.Buckets[i]) / float64(time.Millisecond)
+		}
+		status.Histogram = append(status.Histogram, Bucket{LEMS: le, Count: cumulative})
+	}
+
+	return status
+}
+
+// window sums the slots of the last window, rt.mu must be held
+func (rt *route) window(t *Tracker, epoch int64, window time.Duration) WindowStatus {
+	n := int64(window / t.config.Resolution)
+	ws := WindowStatus{Window: window.String(), SuccessRatio: 1, LatencyRatio: 1}
+
+	for _, s := range rt.slots {
+		if s.epoch > epoch-n && s.epoch <= epoch {
+			ws.Requests += s.requests
+			ws.Errors += s.errors
+			ws.Slow += s.slow
+		}
+	}
+
+	if ws.Requests == 0 {
+		return ws
+	}
+
+	ws.SuccessRatio = 1 - float64(ws.Errors)/float64(ws.Requests)
+	ws.LatencyRatio = 1 - float64(ws.Slow)/float64(ws.Requests)
+	ws.AvailabilityBurnRate = burnRate(1-ws.SuccessRatio, rt.objective.Availability)
+	ws.LatencyBurnRate = burnRate(1-ws.LatencyRatio, rt.objective.LatencyTarget)
+
+	return ws
+}
+
+// burnRate is the observed bad ratio divided by the allowed bad ratio
+func burnRate(bad, target float64) float64 {
+	budget := 1 - target
+	if target <= 0 || budget <= 0 {
+		return 0
+	}
+	return bad / budget
+}
@@ -0,0 +1,89 @@
+package slo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestBurnRate(t *testing.T) {
+	var alerts []Alert
+
+	config := DefaultConfig()
+	config.Windows = []time.Duration{time.Minute, 10 * time.Minute}
+	config.Objective = Objective{Availability: 0.99, Latency: 100 * time.Millisecond, LatencyTarget: 0.9}
+	config.BurnRateThreshold = 5
+	config.OnBurn = func(a Alert) { alerts = append(alerts, a) }
+
+	tracker := New(middleware.New(nil), config)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	// 9 minutes ago: 100 good requests
+	now = now.Add(-9 * time.Minute)
+	for range 100 {
+		tracker.Record("GET /users", http.StatusOK, 10*time.Millisecond)
+	}
+
+	// Now: 10% errors and 20% slow
+	now = now.Add(9 * time.Minute)
+	for i := range 100 {
+		status := http.StatusOK
+		if i%10 == 0 {
+			status = http.StatusInternalServerError
+		}
+		duration := 10 * time.Millisecond
+		if i%5 == 1 {
+			duration = time.Second
+		}
+		tracker.Record("GET /users", status, duration)
+	}
+
+	status := tracker.Status()
+	if len(status) != 1 {
+		t.Fatalf("Expected 1 route, got %d", len(status))
+	}
+
+	minute := status[0].Windows[0]
+	if minute.Requests != 100 || minute.Errors != 10 || minute.Slow != 20 {
+		t.Errorf("Unexpected 1m counters %+v", minute)
+	}
+	if minute.AvailabilityBurnRate < 9.99 || minute.AvailabilityBurnRate > 10.01 {
+		t.Errorf("Expected availability burn rate 10, got %f", minute.AvailabilityBurnRate)
+	}
+	if minute.LatencyBurnRate < 1.99 || minute.LatencyBurnRate > 2.01 {
+		t.Errorf("Expected latency burn rate 2, got %f", minute.LatencyBurnRate)
+	}
+
+	if tenMinutes := status[0].Windows[1]; tenMinutes.Requests != 200 {
+		t.Errorf("Expected 200 requests in 10m window, got %d", tenMinutes.Requests)
+	}
+
+	if len(alerts) == 0 || alerts[0].Objective != "availability" {
+		t.Errorf("Expected availability alert, got %+v", alerts)
+	}
+
+	last := status[0].Histogram[len(status[0].Histogram)-1]
+	if last.LEMS != -1 || last.Count != 200 {
+		t.Errorf("Unexpected +Inf bucket %+v", last)
+	}
+}
+
+func TestHandlerUsesPattern(t *testing.T) {
+	tracker := New(middleware.New(nil), nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	h := tracker.Handler(mux)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	status := tracker.Status()
+	if len(status) != 2 || status[0].Route != "GET /users/{id}" || status[1].Route != UnmatchedRoute {
+		t.Errorf("Unexpected routes %+v", status)
+	}
+}
@@ -0,0 +1,238 @@
+// Package split provides canary routing middleware
+//
+// Requests are sent to one of several variants of a handler. A header or
+// cookie can force a variant, users are assigned by a stable hash of their
+// ID so they keep seeing the same variant, and everything else is split by
+// weight. Weights can be changed at runtime to roll out gradually.
+package split
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// ErrUnknownVariant is returned by SetWeights for names not in Config.Variants
+var ErrUnknownVariant = errors.New("split: unknown variant")
+
+type contextKey struct{}
+
+// Variant is one alternative of the wrapped handler
+type Variant struct {
+	Name string
+	// Handler serving the variant, nil serves the wrapped handler
+	Handler http.Handler
+	// Share of traffic relative to the other weights
+	Weight int
+}
+
+// Config holds split configuration
+type Config struct {
+	Variants []Variant
+	// Header forcing a variant by name, empty disables it
+	Header string
+	// Cookie forcing a variant by name, empty disables it
+	Cookie string
+	// Assign users by a hash of middleware.UserIDKey instead of randomly
+	Sticky bool
+	// Mixed into the sticky hash, change it to reshuffle users
+	Salt string
+}
+
+// DefaultConfig reads the X-Variant header and variant cookie and assigns
+// users sticky. Variants must still be set.
+func DefaultConfig() *Config {
+	return &Config{
+		Header: "X-Variant",
+		Cookie: "variant",
+		Sticky: true,
+	}
+}
+
+// Split routes requests to variants
+type Split struct {
+	mw       *middleware.Middleware
+	config   *Config
+	variants map[string]*variant
+	// Cumulative weights, swapped as a whole by SetWeights
+	weights atomic.Pointer[weightTable]
+}
+
+type variant struct {
+	Variant
+	requests atomic.Int64
+}
+
+type weightTable struct {
+	variants   []*variant
+	cumulative []int
+	total      int
+}
+
+// New creates a split. Use Split.Handler as middleware. It panics if the
+// variant names are not unique or the weights sum to zero.
+func New(mw *middleware.Middleware, config *Config) *Split {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	s := &Split{
+		mw:       mw,
+		config:   config,
+		variants: make(map[string]*variant, len(config.Variants)),
+	}
+
+	initial := make(map[string]int, len(config.Variants))
+	for _, v := range config.Variants {
+		if _, ok := s.variants[v.Name]; ok {
+			panic("split: duplicate variant " + v.Name)
+		}
+		s.variants[v.Name] = &variant{Variant: v}
+		initial[v.Name] = v.Weight
+	}
+
+	if err := s.SetWeights(initial); err != nil {
+		panic(err.Error())
+	}
+	return s
+}
+
+// Handler routes every request to a variant, use it as middleware.MiddlewareFunc
+func (s *Split) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.mw.ShouldSkip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v, reason := s.choose(r)
+		v.requests.Add(1)
+
+		ctx := ContextWithVariant(r.Context(), v.Name)
+		middleware.AddRequestAttrs(ctx,
+			slog.String("variant", v.Name),
+			slog.String("variant_reason", reason),
+		)
+		if logger, ok := ctx.Value(middleware.LoggerKey).(*slog.Logger); ok {
+			ctx = middleware.ContextWithLogger(ctx, logger.With(slog.String("variant", v.Name)))
+		}
+
+		handler := v.Handler
+		if handler == nil {
+			handler = next
+		}
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// choose returns the variant for r and why it was chosen
+func (s *Split) choose(r *http.Request) (*variant, string) {
+	if s.config.Header != "" {
+		if v, ok := s.variants[r.Header.Get(s.config.Header)]; ok {
+			return v, "header"
+		}
+	}
+
+	if s.config.Cookie != "" {
+		if cookie, err := r.Cookie(s.config.Cookie); err == nil {
+			if v, ok := s.variants[cookie.Value]; ok {
+				return v, "cookie"
+			}
+		}
+	}
+
+	w := s.weights.Load()
+	if s.config.Sticky {
+		if id, ok := r.Context().Value(middleware.UserIDKey).(string); ok && id != "" {
+			h := fnv.New64a()
+			h.Write([]byte(s.config.Salt))
+			h.Write([]byte(id))
+			return w.pick(int(h.Sum64() % uint64(w.total))), "sticky"
+		}
+	}
+
+	return w.pick(rand.IntN(w.total)), "weight"
+}
+
+// pick returns the variant whose cumulative weight range contains n
+func (w *weightTable) pick(n int) *variant {
+	for i, limit := range w.cumulative {
+		if n < limit {
+			return w.variants[i]
+		}
+	}
+	return w.variants[len(w.variants)-1]
+}
+
+// SetWeights changes the traffic shares. Variants missing from weights get
+// weight 0, header and cookie overrides still reach them. With two
+// variants and a constant total, e.g. percentages, raising the canary's
+// weight only moves sticky users onto it, none move back.
+func (s *Split) SetWeights(weights map[string]int) error {
+	for name, weight := range weights {
+		if _, ok := s.variants[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownVariant, name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("split: negative weight for %s", name)
+		}
+	}
+
+	next := &weightTable{}
+	// Keep the configured order so the hash ranges stay in place
+	for _, v := range s.config.Variants {
+		if weight := weights[v.Name]; weight > 0 {
+			next.total += weight
+			next.variants = append(next.variants, s.variants[v.Name])
+			next.cumulative = append(next.cumulative, next.total)
+		}
+	}
+	if next.total == 0 {
+		return errors.New("split: weights sum to zero")
+	}
+
+	s.weights.Store(next)
+	return nil
+}
+
+// Weights returns the current traffic shares
+func (s *Split) Weights() map[string]int {
+	w := s.weights.Load()
+	weights := make(map[string]int, len(s.variants))
+	for name := range s.variants {
+		weights[name] = 0
+	}
+	prev := 0
+	for i, v := range w.variants {
+		weights[v.Name] = w.cumulative[i] - prev
+		prev = w.cumulative[i]
+	}
+	return weights
+}
+
+// Stats returns the number of requests per variant since start
+func (s *Split) Stats() map[string]int64 {
+	stats := make(map[string]int64, len(s.variants))
+	for name, v := range s.variants {
+		stats[name] = v.requests.Load()
+	}
+	return stats
+}
+
+// ContextWithVariant returns a copy of ctx carrying the variant name
+func ContextWithVariant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// FromContext returns the variant of the request, "" outside a Split
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(contextKey{}).(string)
+	return name
+}
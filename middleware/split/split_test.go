@@ -0,0 +1,149 @@
+package split
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func variantHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func newSplit(mw *middleware.Middleware, control, canary int) *Split {
+	config := DefaultConfig()
+	config.Variants = []Variant{
+		{Name: "control", Weight: control},
+		{Name: "canary", Handler: variantHandler("canary"), Weight: canary},
+	}
+	return New(mw, config)
+}
+
+func serve(h http.Handler, r *http.Request) string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec.Body.String()
+}
+
+func TestChoose(t *testing.T) {
+	s := newSplit(middleware.New(nil), 100, 0)
+	h := s.Handler(variantHandler("control"))
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   string
+	}{
+		{"weight", "", "", "control"},
+		{"header", "canary", "", "canary"},
+		{"cookie", "", "canary", "canary"},
+		{"unknown header", "beta", "", "control"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Variant", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "variant", Value: tt.cookie})
+			}
+
+			if got := serve(h, r); got != tt.want {
+				t.Errorf("variant = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSticky(t *testing.T) {
+	s := newSplit(middleware.New(nil), 90, 10)
+	h := s.Handler(variantHandler("control"))
+
+	assign := func() map[string]string {
+		assigned := make(map[string]string)
+		for i := range 1000 {
+			id := fmt.Sprintf("user-%d", i)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), middleware.UserIDKey, id))
+			assigned[id] = serve(h, r)
+		}
+		return assigned
+	}
+
+	before := assign()
+	if again := assign(); fmt.Sprint(again) != fmt.Sprint(before) {
+		t.Fatal("sticky assignment changed between requests")
+	}
+
+	if err := s.SetWeights(map[string]int{"control": 70, "canary": 30}); err != nil {
+		t.Fatal(err)
+	}
+	after := assign()
+
+	canary := 0
+	for id, v := range after {
+		if before[id] == "canary" && v != "canary" {
+			t.Fatalf("%s moved off the canary after raising its weight", id)
+		}
+		if v == "canary" {
+			canary++
+		}
+	}
+	if canary < 250 || canary > 350 {
+		t.Errorf("canary users = %d of 1000, want about 300", canary)
+	}
+	if got := s.Weights(); got["canary"] != 30 || got["control"] != 70 {
+		t.Errorf("Weights() = %v", got)
+	}
+}
+
+func TestSetWeightsErrors(t *testing.T) {
+	s := newSplit(middleware.New(nil), 1, 1)
+
+	if err := s.SetWeights(map[string]int{"beta": 1}); !errors.Is(err, ErrUnknownVariant) {
+		t.Errorf("unknown variant: err = %v", err)
+	}
+	if err := s.SetWeights(map[string]int{"control": 0}); err == nil {
+		t.Error("zero total accepted")
+	}
+	if got := s.Weights(); got["control"] != 1 || got["canary"] != 1 {
+		t.Errorf("weights changed by failed SetWeights: %v", got)
+	}
+}
+
+func TestRequestAttrs(t *testing.T) {
+	var logs bytes.Buffer
+	mw := middleware.New(slog.New(slog.NewJSONHandler(&logs, nil)))
+	s := newSplit(mw, 0, 1)
+
+	var fromContext string
+	h := mw.LogRequest(s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	s.variants["canary"].Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = FromContext(r.Context())
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if fromContext != "canary" {
+		t.Errorf("FromContext = %q, want canary", fromContext)
+	}
+	if !strings.Contains(logs.String(), `"variant":"canary","variant_reason":"weight"`) {
+		t.Errorf("request log lacks variant: %s", logs.String())
+	}
+	if got := s.Stats()["canary"]; got != 1 {
+		t.Errorf("Stats()[canary] = %d, want 1", got)
+	}
+}
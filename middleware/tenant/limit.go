@@ -0,0 +1,127 @@
+package tenant
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/cors"
+)
+
+// CORS creates CORS middleware that uses the tenant's AllowedOrigins and
+// config for everything else. Place it after the tenant middleware. Browsers
+// send preflight requests without custom headers, so resolve the tenant from
+// the host or path when using it.
+func CORS(mw *middleware.Middleware, config *cors.Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = cors.DefaultConfig()
+	}
+
+	type tenantCORS struct {
+		origins []string
+		handler http.Handler
+	}
+
+	return func(next http.Handler) http.Handler {
+		var handlers sync.Map // tenant ID -> *tenantCORS
+		fallback := cors.New(mw, config)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, ok := FromContext(r.Context())
+			if !ok || len(t.AllowedOrigins) == 0 {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+
+			// Tenants whose origins changed get a new handler
+			v, ok := handlers.Load(t.ID)
+			if !ok || !slices.Equal(v.(*tenantCORS).origins, t.AllowedOrigins) {
+				tenantConfig := *config
+				tenantConfig.AllowedOrigins = slices.Clone(t.AllowedOrigins)
+				v = &tenantCORS{
+					origins: tenantConfig.AllowedOrigins,
+					handler: cors.New(mw, &tenantConfig)(next),
+				}
+				handlers.Store(t.ID, v)
+			}
+			v.(*tenantCORS).handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit limits requests per tenant with a token bucket configured by
+// the tenant's RateLimit and Burst. Place it after the tenant middleware.
+func RateLimit(mw *middleware.Middleware) middleware.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		var (
+			mu      sync.Mutex
+			buckets = make(map[string]*bucket)
+		)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, ok := FromContext(r.Context())
+			if !ok || t.RateLimit <= 0 || mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mu.Lock()
+			b, ok := buckets[t.ID]
+			if !ok {
+				b = &bucket{}
+				buckets[t.ID] = b
+			}
+			wait := b.take(time.Now(), t.RateLimit, max(t.Burst, 1))
+			mu.Unlock()
+
+			if wait == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			traceID := middleware.GetTraceIDFromContext(r.Context())
+			mw.Logger().Warn("tenant rate limited",
+				slog.String("trace_id", traceID),
+				slog.String("tenant_id", t.ID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			)
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":    "rate limit exceeded",
+				"trace_id": traceID,
+			})
+		})
+	}
+}
+
+// bucket is a token bucket refilled at rate tokens per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token and returns 0, or the time until one is available
+func (b *bucket) take(now time.Time, rate float64, burst int) time.Duration {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
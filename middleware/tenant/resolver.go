@@ -0,0 +1,101 @@
+package tenant
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver finds the tenant ID of a request
+type Resolver interface {
+	ResolveTenant(r *http.Request) (id string, ok bool)
+}
+
+// ResolverFunc adapts a function to Resolver
+type ResolverFunc func(r *http.Request) (string, bool)
+
+// ResolveTenant calls f(r)
+func (f ResolverFunc) ResolveTenant(r *http.Request) (string, bool) {
+	return f(r)
+}
+
+// Subdomain resolves "acme" from "acme.example.com" for domain "example.com"
+func Subdomain(domain string) Resolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+
+	return ResolverFunc(func(r *http.Request) (string, bool) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+		sub, ok := strings.CutSuffix(host, suffix)
+		if !ok || sub == "" || strings.Contains(sub, ".") {
+			return "", false
+		}
+		return sub, true
+	})
+}
+
+// Header resolves the tenant from a request header, e.g. "X-Tenant-Id"
+func Header(name string) Resolver {
+	return ResolverFunc(func(r *http.Request) (string, bool) {
+		id := strings.TrimSpace(r.Header.Get(name))
+		return id, id != ""
+	})
+}
+
+// PathPrefix resolves "acme" from "/acme/users". Routes then include the
+// tenant segment, e.g. "GET /{tenant}/users".
+func PathPrefix() Resolver {
+	return ResolverFunc(func(r *http.Request) (string, bool) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		id, _, _ := strings.Cut(path, "/")
+		return id, id != ""
+	})
+}
+
+// JWTClaim resolves the tenant from a string claim of the bearer token.
+// The token is not verified, only use it behind middleware that rejects
+// requests with invalid tokens.
+func JWTClaim(claim string) Resolver {
+	return ResolverFunc(func(r *http.Request) (string, bool) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", false
+		}
+
+		parts := strings.Split(strings.TrimSpace(token), ".")
+		if len(parts) != 3 {
+			return "", false
+		}
+
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return "", false
+		}
+
+		var claims map[string]any
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return "", false
+		}
+
+		id, _ := claims[claim].(string)
+		return id, id != ""
+	})
+}
+
+// First tries resolvers in order and returns the first match
+func First(resolvers ...Resolver) Resolver {
+	return ResolverFunc(func(r *http.Request) (string, bool) {
+		for _, res := range resolvers {
+			if id, ok := res.ResolveTenant(r); ok {
+				return id, true
+			}
+		}
+		return "", false
+	})
+}
@@ -0,0 +1,156 @@
+// Package tenant provides multi-tenant resolution middleware
+//
+// A Resolver finds the tenant ID of a request, e.g. from the subdomain or a
+// header, and a Store looks up the tenant. Unknown tenants get a JSON 404.
+// The tenant is stored in the context and added to the LogRequest entry.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// ErrNotFound is returned by a Store for unknown tenants
+var ErrNotFound = errors.New("tenant: not found")
+
+type contextKey struct{}
+
+// Tenant holds a tenant and its configuration
+type Tenant struct {
+	ID   string
+	Name string
+	// Origins allowed by the CORS middleware of this package
+	AllowedOrigins []string
+	// Requests per second allowed by RateLimit, 0 means unlimited
+	RateLimit float64
+	// Maximum burst above RateLimit
+	Burst int
+	// Application specific settings
+	Settings map[string]string
+}
+
+// Store looks up tenants by ID
+type Store interface {
+	Tenant(ctx context.Context, id string) (*Tenant, error)
+}
+
+// StaticStore is a Store backed by a map keyed by tenant ID
+type StaticStore map[string]*Tenant
+
+// Tenant returns the tenant with id or ErrNotFound
+func (s StaticStore) Tenant(ctx context.Context, id string) (*Tenant, error) {
+	if t, ok := s[id]; ok {
+		return t, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Config holds tenant configuration
+type Config struct {
+	// Resolver finds the tenant ID of a request
+	Resolver Resolver
+	// Store looks up the tenant, it must be set
+	Store Store
+}
+
+// DefaultConfig resolves the tenant from the X-Tenant-Id header.
+// Store must still be set.
+func DefaultConfig() *Config {
+	return &Config{
+		Resolver: Header("X-Tenant-Id"),
+	}
+}
+
+// New creates tenant middleware with custom config.
+// It panics if config.Store is nil.
+func New(mw *middleware.Middleware, config *Config) middleware.MiddlewareFunc {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Resolver == nil {
+		config.Resolver = DefaultConfig().Resolver
+	}
+	if config.Store == nil {
+		panic("tenant: Config.Store is required")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mw.ShouldSkip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id, ok := config.Resolver.ResolveTenant(r)
+			if !ok {
+				reject(mw, w, r, "", nil)
+				return
+			}
+
+			t, err := config.Store.Tenant(r.Context(), id)
+			if err != nil {
+				reject(mw, w, r, id, err)
+				return
+			}
+
+			ctx := ContextWithTenant(r.Context(), t)
+			middleware.AddRequestAttrs(ctx, slog.String("tenant_id", t.ID))
+			if logger, ok := ctx.Value(middleware.LoggerKey).(*slog.Logger); ok {
+				ctx = middleware.ContextWithLogger(ctx, logger.With(slog.String("tenant_id", t.ID)))
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func reject(mw *middleware.Middleware, w http.ResponseWriter, r *http.Request, id string, err error) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	attrs := []any{
+		slog.String("trace_id", traceID),
+		slog.String("tenant_id", id),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	}
+
+	// Store failures are not the client's fault
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		mw.Logger().Error("tenant lookup failed", append(attrs, slog.String("error", err.Error()))...)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":    "internal server error",
+			"trace_id": traceID,
+		})
+		return
+	}
+
+	mw.Logger().Warn("unknown tenant", attrs...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    "tenant not found",
+		"trace_id": traceID,
+	})
+}
+
+// ContextWithTenant returns a copy of ctx carrying t. The tenant ID is also
+// stored under middleware.TenantIDKey for middleware.ContextHandler.
+func ContextWithTenant(ctx context.Context, t *Tenant) context.Context {
+	ctx = context.WithValue(ctx, contextKey{}, t)
+	return context.WithValue(ctx, middleware.TenantIDKey, t.ID)
+}
+
+// FromContext returns the tenant stored by the middleware
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+	return t, ok
+}
@@ -0,0 +1,159 @@
+package tenant
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+var store = StaticStore{
+	"acme":   {ID: "acme", AllowedOrigins: []string{"https://acme.example"}, RateLimit: 1, Burst: 2},
+	"globex": {ID: "globex"},
+}
+
+func TestResolvers(t *testing.T) {
+	token := "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"tenant":"acme"}`)) + ".sig"
+
+	tests := []struct {
+		name     string
+		resolver Resolver
+		host     string
+		path     string
+		header   http.Header
+		want     string
+	}{
+		{"subdomain", Subdomain("example.com"), "acme.example.com:8080", "/", nil, "acme"},
+		{"apex", Subdomain("example.com"), "example.com", "/", nil, ""},
+		{"nested subdomain", Subdomain("example.com"), "a.b.example.com", "/", nil, ""},
+		{"header", Header("X-Tenant-Id"), "", "/", http.Header{"X-Tenant-Id": {"acme"}}, "acme"},
+		{"path", PathPrefix(), "", "/acme/users", nil, "acme"},
+		{"jwt", JWTClaim("tenant"), "", "/", http.Header{"Authorization": {"Bearer " + token}}, "acme"},
+		{"first", First(Header("X-Tenant-Id"), PathPrefix()), "", "/globex/users", nil, "globex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+
+			got, ok := tt.resolver.ResolveTenant(r)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("Expected %q, got %q %v", tt.want, got, ok)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	mw := middleware.New(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	var got string
+	h := mw.LogRequest(New(mw, &Config{Resolver: Header("X-Tenant-Id"), Store: store})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, _ := FromContext(r.Context())
+			got = tenant.ID
+		}),
+	))
+
+	tests := []struct {
+		tenant     string
+		wantStatus int
+	}{
+		{"acme", http.StatusOK},
+		{"initech", http.StatusNotFound},
+		{"", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		buf.Reset()
+		got = ""
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Tenant-Id", tt.tenant)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("Tenant %q: expected %d, got %d", tt.tenant, tt.wantStatus, w.Code)
+		}
+		if tt.wantStatus == http.StatusOK {
+			if got != tt.tenant {
+				t.Errorf("Expected tenant %q in context, got %q", tt.tenant, got)
+			}
+			if !strings.Contains(buf.String(), `"tenant_id":"acme"`) {
+				t.Errorf("Expected tenant_id in request log, got %s", buf.String())
+			}
+		}
+	}
+}
+
+func TestPerTenantConfig(t *testing.T) {
+	mw := middleware.New(nil)
+	h := New(mw, &Config{Resolver: Header("X-Tenant-Id"), Store: store})(
+		CORS(mw, nil)(RateLimit(mw)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))),
+	)
+
+	request := func(tenant, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Tenant-Id", tenant)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if got := request("acme", "https://acme.example").Header().Get("Access-Control-Allow-Origin"); got != "https://acme.example" {
+		t.Errorf("Expected tenant origin to be allowed, got %q", got)
+	}
+	if got := request("acme", "https://evil.example").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected foreign origin to be rejected, got %q", got)
+	}
+
+	// Burst of 2 is used up by the requests above
+	w := request("acme", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", w.Code)
+	}
+	if w := request("globex", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected unlimited tenant to pass, got %d", w.Code)
+	}
+}
+
+func TestCORSOriginsChange(t *testing.T) {
+	mw := middleware.New(nil)
+	tenants := StaticStore{"acme": {ID: "acme", AllowedOrigins: []string{"https://old.example"}}}
+	h := New(mw, &Config{Resolver: Header("X-Tenant-Id"), Store: tenants})(
+		CORS(mw, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+	)
+
+	allowed := func(origin string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Tenant-Id", "acme")
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	if !allowed("https://old.example") {
+		t.Fatal("Expected old origin to be allowed")
+	}
+
+	tenants["acme"] = &Tenant{ID: "acme", AllowedOrigins: []string{"https://new.example"}}
+	if !allowed("https://new.example") {
+		t.Error("Expected changed origins to take effect")
+	}
+	if allowed("https://old.example") {
+		t.Error("Expected old origin to be rejected after the change")
+	}
+}
@@ -0,0 +1,267 @@
+// Package versioning routes requests to version specific handlers
+//
+// The version is read from a path prefix ("/v2/users"), a header
+// ("Api-Version: 2") or a media type parameter ("Accept:
+// application/json;version=2"). Deprecated versions get Deprecation, Sunset
+// and Link headers, and their remaining traffic is logged periodically.
+package versioning
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/negotiate"
+)
+
+type contextKey struct{}
+
+// Version is one API version and its handler
+type Version struct {
+	// Name as used in paths, e.g. "v1". Headers and media type
+	// parameters may omit the "v", "1" and "v1" are the same version.
+	Name    string
+	Handler http.Handler
+	// Deprecated since this time, zero if not deprecated
+	Deprecated time.Time
+	// Removal date announced in the Sunset header, zero if unknown
+	Sunset time.Time
+	// Documentation of the deprecation, e.g. a migration guide
+	Link string
+}
+
+// Config holds versioning configuration
+type Config struct {
+	Versions []Version
+	// Version used when the request names none, e.g. the oldest for
+	// clients that predate versioning
+	Default string
+	// Read the version from the first path segment and strip it
+	PathPrefix bool
+	// Header naming the version, empty disables it
+	Header string
+	// Accept media type parameter naming the version, empty disables it
+	MediaTypeParam string
+	// How often the traffic of deprecated versions is logged
+	ReportInterval time.Duration
+}
+
+// DefaultConfig reads path prefixes, the Api-Version header and the
+// version media type parameter
+func DefaultConfig() *Config {
+	return &Config{
+		PathPrefix:     true,
+		Header:         "Api-Version",
+		MediaTypeParam: "version",
+		ReportInterval: time.Minute,
+	}
+}
+
+// Router dispatches requests to the handler of the requested version
+type Router struct {
+	mw       *middleware.Middleware
+	config   *Config
+	versions map[string]*version
+	names    []string
+	vary     string
+}
+
+type version struct {
+	Version
+	deprecation string
+	sunset      string
+	link        string
+
+	requests   atomic.Int64
+	mu         sync.Mutex
+	reported   int64
+	reportedAt time.Time
+}
+
+// New creates a version router
+func New(mw *middleware.Middleware, config *Config) *Router {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	rt := &Router{
+		mw:       mw,
+		config:   config,
+		versions: make(map[string]*version, len(config.Versions)),
+	}
+
+	now := time.Now()
+	for _, v := range config.Versions {
+		ver := &version{Version: v, reportedAt: now}
+		if !v.Deprecated.IsZero() {
+			// RFC 9745 structured field date
+			ver.deprecation = "@" + strconv.FormatInt(v.Deprecated.Unix(), 10)
+		}
+		if !v.Sunset.IsZero() {
+			ver.sunset = v.Sunset.UTC().Format(http.TimeFormat)
+		}
+		if v.Link != "" {
+			ver.link = "<" + v.Link + `>; rel="deprecation"; type="text/html"`
+		}
+		rt.versions[normalize(v.Name)] = ver
+		rt.names = append(rt.names, v.Name)
+	}
+
+	// Request headers the version may come from
+	var vary []string
+	if config.Header != "" {
+		vary = append(vary, config.Header)
+	}
+	if config.MediaTypeParam != "" {
+		vary = append(vary, "Accept")
+	}
+	rt.vary = strings.Join(vary, ", ")
+
+	return rt
+}
+
+// ServeHTTP routes r to the handler of its version
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, r := rt.resolve(r)
+
+	ver, ok := rt.versions[normalize(name)]
+	if !ok {
+		rt.unsupported(w, r, name)
+		return
+	}
+
+	if ver.deprecation != "" {
+		w.Header().Set("Deprecation", ver.deprecation)
+		if ver.sunset != "" {
+			w.Header().Set("Sunset", ver.sunset)
+		}
+		if ver.link != "" {
+			w.Header().Add("Link", ver.link)
+		}
+		rt.count(ver)
+	}
+
+	if rt.vary != "" {
+		w.Header().Add("Vary", rt.vary)
+	}
+
+	ctx := context.WithValue(r.Context(), contextKey{}, ver.Name)
+	middleware.AddRequestAttrs(ctx, slog.String("api_version", ver.Name))
+
+	ver.Handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// resolve returns the requested version and r with a version path prefix removed
+func (rt *Router) resolve(r *http.Request) (string, *http.Request) {
+	if rt.config.PathPrefix {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if _, ok := rt.versions[normalize(segment)]; ok && segment != "" {
+			return segment, stripPrefix(r, "/"+segment)
+		}
+	}
+
+	if rt.config.Header != "" {
+		if name := strings.TrimSpace(r.Header.Get(rt.config.Header)); name != "" {
+			return name, r
+		}
+	}
+
+	if rt.config.MediaTypeParam != "" {
+		for _, mr := range negotiate.ParseAccept(r.Header.Get("Accept")) {
+			if name := mr.Params[rt.config.MediaTypeParam]; name != "" {
+				return name, r
+			}
+		}
+	}
+
+	return rt.config.Default, r
+}
+
+// stripPrefix works like http.StripPrefix on a shallow copy of r
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+	if r2.URL.Path == "" {
+		r2.URL.Path = "/"
+	}
+	return r2
+}
+
+func (rt *Router) unsupported(w http.ResponseWriter, r *http.Request, name string) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	message := "unsupported api version"
+	if name == "" {
+		message = "api version required"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":     message,
+		"available": rt.names,
+		"trace_id":  traceID,
+	})
+}
+
+// count logs the traffic of a deprecated version once per ReportInterval
+func (rt *Router) count(ver *version) {
+	total := ver.requests.Add(1)
+
+	if rt.config.ReportInterval <= 0 || !ver.mu.TryLock() {
+		return
+	}
+	defer ver.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(ver.reportedAt)
+	if elapsed < rt.config.ReportInterval {
+		return
+	}
+
+	attrs := []any{
+		slog.String("version", ver.Name),
+		slog.Int64("requests", total-ver.reported),
+		slog.Duration("interval", elapsed),
+	}
+	if !ver.Sunset.IsZero() {
+		attrs = append(attrs, slog.Time("sunset", ver.Sunset))
+	}
+	rt.mw.Logger().Warn("deprecated api version used", attrs...)
+
+	ver.reported = total
+	ver.reportedAt = now
+}
+
+// Stats returns the number of requests per deprecated version since start
+func (rt *Router) Stats() map[string]int64 {
+	stats := make(map[string]int64)
+	for _, ver := range rt.versions {
+		if ver.deprecation != "" {
+			stats[ver.Name] = ver.requests.Load()
+		}
+	}
+	return stats
+}
+
+// FromContext returns the version of the request, "" outside a Router
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(contextKey{}).(string)
+	return name
+}
+
+func normalize(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "v")
+}
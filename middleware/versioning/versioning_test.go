@@ -0,0 +1,88 @@
+package versioning
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func echo(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name+" "+r.URL.Path+" "+FromContext(r.Context()))
+	})
+}
+
+func TestRouter(t *testing.T) {
+	var logs bytes.Buffer
+	mw := middleware.New(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	deprecated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	config := DefaultConfig()
+	config.Default = "v1"
+	config.ReportInterval = time.Nanosecond
+	config.Versions = []Version{
+		{Name: "v1", Handler: echo("one"), Deprecated: deprecated, Sunset: sunset, Link: "https://example.com/migrate"},
+		{Name: "v2", Handler: echo("two")},
+	}
+	router := New(mw, config)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     http.Header
+		wantStatus int
+		wantBody   string
+	}{
+		{"path", "/v2/users", nil, http.StatusOK, "two /users v2"},
+		{"header", "/users", http.Header{"Api-Version": {"2"}}, http.StatusOK, "two /users v2"},
+		{"accept", "/users", http.Header{"Accept": {"application/json;version=v2"}}, http.StatusOK, "two /users v2"},
+		{"default", "/users", nil, http.StatusOK, "one /users v1"},
+		{"unknown", "/users", http.Header{"Api-Version": {"9"}}, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+
+	if got := w.Header().Get("Deprecation"); got != "@1767225600" {
+		t.Errorf("Unexpected Deprecation %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Thu, 31 Dec 2026 00:00:00 GMT" {
+		t.Errorf("Unexpected Sunset %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `<https://example.com/migrate>; rel="deprecation"; type="text/html"` {
+		t.Errorf("Unexpected Link %q", got)
+	}
+	if stats := router.Stats(); stats["v1"] != 2 || len(stats) != 1 {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+	if !strings.Contains(logs.String(), "deprecated api version used") {
+		t.Errorf("Expected deprecated traffic to be logged, got %s", logs.String())
+	}
+}
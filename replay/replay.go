@@ -0,0 +1,259 @@
+// Package replay sends recorded traffic against a handler or server and
+// reports how the responses differ from the recording.
+//
+// Recordings are JSON Lines written by the middleware/recorder package.
+// Exchanges are replayed one after another in recorded order.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bit8bytes/toolbox/middleware/recorder"
+)
+
+// Config holds replay configuration
+type Config struct {
+	// Handler to replay against in-process (takes precedence over BaseURL)
+	Handler http.Handler
+	// Server to replay against, e.g. http://localhost:8080
+	BaseURL string
+	// HTTP client used with BaseURL
+	Client *http.Client
+	// Response headers that are expected to differ between runs
+	IgnoreHeaders []string
+	// JSON body paths that are expected to differ, e.g. "created_at"
+	IgnoreJSONPaths []string
+}
+
+// DefaultConfig ignores headers that change on every request
+func DefaultConfig() *Config {
+	return &Config{
+		Client: &http.Client{},
+		IgnoreHeaders: []string{
+			"Date",
+			"Content-Length",
+			"Server-Timing",
+			"Set-Cookie",
+		},
+	}
+}
+
+// Result is the outcome of replaying one exchange
+type Result struct {
+	Exchange *recorder.Exchange
+	Status   int
+	Header   http.Header
+	Body     []byte
+	// Differences between recorded and replayed response
+	Diffs []string
+	// Err is set if the request could not be sent
+	Err error
+}
+
+// OK reports whether the replayed response matched the recording
+func (res *Result) OK() bool {
+	return res.Err == nil && len(res.Diffs) == 0
+}
+
+// Read parses a JSON Lines recording
+func Read(r io.Reader) ([]*recorder.Exchange, error) {
+	var exchanges []*recorder.Exchange
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		ex := &recorder.Exchange{}
+		if err := json.Unmarshal(scanner.Bytes(), ex); err != nil {
+			return nil, fmt.Errorf("replay: line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+
+	return exchanges, scanner.Err()
+}
+
+// Run replays all exchanges in order and returns one result per exchange
+func Run(ctx context.Context, exchanges []*recorder.Exchange, config *Config) []*Result {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+
+	results := make([]*Result, 0, len(exchanges))
+	for _, ex := range exchanges {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, replay(ctx, ex, config))
+	}
+	return results
+}
+
+func replay(ctx context.Context, ex *recorder.Exchange, config *Config) *Result {
+	res := &Result{Exchange: ex}
+
+	if ex.Request.Truncated {
+		res.Err = fmt.Errorf("request body was truncated while recording")
+		return res
+	}
+
+	target := ex.Request.URL
+	if config.Handler == nil {
+		target = strings.TrimSuffix(config.BaseURL, "/") + ex.Request.URL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, ex.Request.Method, target, bytes.NewReader(ex.Request.Body))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	req.Header = ex.Request.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Host = ex.Request.Host
+
+	if config.Handler != nil {
+		rec := httptest.NewRecorder()
+		config.Handler.ServeHTTP(rec, req)
+		res.Status = rec.Code
+		res.Header = rec.Header()
+		res.Body = rec.Body.Bytes()
+	} else {
+		resp, err := config.Client.Do(req)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		defer resp.Body.Close()
+
+		res.Status = resp.StatusCode
+		res.Header = resp.Header
+		res.Body, res.Err = io.ReadAll(resp.Body)
+	}
+
+	res.Diffs = Diff(&ex.Response, res.Status, res.Header, res.Body, config)
+	return res
+}
+
+// Diff compares a recorded response with a replayed one
+func Diff(want *recorder.Response, status int, header http.Header, body []byte, config *Config) []string {
+	var diffs []string
+
+	if want.Status != status {
+		diffs = append(diffs, fmt.Sprintf("status: recorded %d, got %d", want.Status, status))
+	}
+
+	// Only recorded headers are compared, servers add headers like
+	// Content-Type after the handler ran
+	keys := make([]string, 0, len(want.Header))
+	for key := range want.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if slices.ContainsFunc(config.IgnoreHeaders, func(h string) bool { return strings.EqualFold(h, key) }) {
+			continue
+		}
+		if a, b := want.Header[key], header[key]; !slices.Equal(a, b) {
+			diffs = append(diffs, fmt.Sprintf("header %s: recorded %q, got %q", key, a, b))
+		}
+	}
+
+	return append(diffs, diffBody(want, body, config)...)
+}
+
+func diffBody(want *recorder.Response, body []byte, config *Config) []string {
+	recorded := want.Body
+	if want.Truncated && len(body) > len(recorded) {
+		// Only the recorded prefix can be compared
+		body = body[:len(recorded)]
+	}
+
+	if bytes.Equal(recorded, body) {
+		return nil
+	}
+
+	var a, b any
+	if !want.Truncated && json.Unmarshal(recorded, &a) == nil && json.Unmarshal(body, &b) == nil {
+		var diffs []string
+		diffJSON("body", a, b, config.IgnoreJSONPaths, &diffs)
+		return diffs
+	}
+
+	return []string{fmt.Sprintf("body: recorded %d bytes, got %d bytes", len(recorded), len(body))}
+}
+
+func diffJSON(path string, a, b any, ignore []string, diffs *[]string) {
+	if slices.Contains(ignore, strings.TrimPrefix(path, "body.")) {
+		return
+	}
+
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffJSON(path+"."+k, av[k], bv[k], ignore, diffs)
+		}
+		return
+
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		if len(av) != len(bv) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: recorded %d items, got %d", path, len(av), len(bv)))
+			return
+		}
+		for i := range av {
+			diffJSON(fmt.Sprintf("%s.%d", path, i), av[i], bv[i], ignore, diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: recorded %s, got %s", path, compact(a), compact(b)))
+	}
+}
+
+func compact(v any) string {
+	if v == nil {
+		return "<missing>"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,93 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/recorder"
+)
+
+func record(t *testing.T, h http.Handler, req *http.Request) []*recorder.Exchange {
+	t.Helper()
+
+	var buf bytes.Buffer
+	config := recorder.DefaultConfig()
+	config.SampleRate = 1
+	config.Output = &buf
+
+	recorder.New(middleware.New(nil), config)(h).ServeHTTP(httptest.NewRecorder(), req)
+
+	exchanges, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(exchanges) != 1 {
+		t.Fatalf("Expected 1 exchange, got %d", len(exchanges))
+	}
+	return exchanges
+}
+
+func TestReplayHandler(t *testing.T) {
+	version := "1"
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body bytes.Buffer
+		body.ReadFrom(r.Body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":"` + body.String() + `","version":` + version + `,"created_at":"` + version + `"}`))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello"))
+	req.Header.Set("Authorization", "Bearer secret")
+	exchanges := record(t, h, req)
+
+	if got := exchanges[0].Request.Header.Get("Authorization"); got != "[REDACTED]" {
+		t.Errorf("Authorization should be redacted, got %q", got)
+	}
+
+	config := DefaultConfig()
+	config.Handler = h
+
+	results := Run(context.Background(), exchanges, config)
+	if !results[0].OK() {
+		t.Errorf("Unchanged handler should match, got %v", results[0].Diffs)
+	}
+
+	version = "2"
+	config.IgnoreJSONPaths = []string{"created_at"}
+
+	results = Run(context.Background(), exchanges, config)
+	diffs := results[0].Diffs
+	if len(diffs) != 1 || diffs[0] != "body.version: recorded 1, got 2" {
+		t.Errorf("Unexpected diffs %v", diffs)
+	}
+}
+
+func TestReplayServer(t *testing.T) {
+	status := http.StatusOK
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+
+	exchanges := record(t, h, httptest.NewRequest(http.MethodGet, "/health?verbose=1", nil))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.BaseURL = srv.URL
+
+	status = http.StatusServiceUnavailable
+	results := Run(context.Background(), exchanges, config)
+	if results[0].Err != nil {
+		t.Fatalf("Unexpected error %v", results[0].Err)
+	}
+	if diffs := results[0].Diffs; len(diffs) != 1 || !strings.HasPrefix(diffs[0], "status:") {
+		t.Errorf("Expected status diff, got %v", diffs)
+	}
+}
@@ -0,0 +1,119 @@
+package responder
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Typed errors let handlers describe a failure, the error handler adapter
+// turns them into the matching response. They are found with errors.As, so
+// they may be wrapped with fmt.Errorf("...: %w", err). The message of Err is
+// sent to the client, leave Err nil for a generic message.
+
+// NotFoundError results in 404 Not Found
+type NotFoundError struct {
+	Err error
+}
+
+func (e *NotFoundError) Error() string {
+	return errorString(e.Err, "the requested resource could not be found")
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError results in 422 Unprocessable Entity with the field messages
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	return "failed validation"
+}
+
+// ConflictError results in 409 Conflict, e.g. a duplicate email or an edit conflict
+type ConflictError struct {
+	Err error
+}
+
+func (e *ConflictError) Error() string {
+	return errorString(e.Err, "the resource was modified or already exists")
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// UnauthorizedError results in 401 Unauthorized
+type UnauthorizedError struct {
+	Err error
+}
+
+func (e *UnauthorizedError) Error() string {
+	return errorString(e.Err, "invalid authentication credentials")
+}
+
+func (e *UnauthorizedError) Unwrap() error {
+	return e.Err
+}
+
+// BadRequestError results in 400 Bad Request
+type BadRequestError struct {
+	Err error
+}
+
+func (e *BadRequestError) Error() string {
+	return errorString(e.Err, "bad request")
+}
+
+func (e *BadRequestError) Unwrap() error {
+	return e.Err
+}
+
+// TooLargeError results in 413 Content Too Large
+type TooLargeError struct {
+	// Limit is the maximum body size in bytes
+	Limit int64
+	// Err replaces the message about Limit, e.g. for a compression ratio
+	Err error
+}
+
+func (e *TooLargeError) Error() string {
+	return errorString(e.Err, fmt.Sprintf("body must not be larger than %d bytes", e.Limit))
+}
+
+func (e *TooLargeError) Unwrap() error {
+	return e.Err
+}
+
+// StackError carries the stack of the goroutine that wrapped Err. Unexpected
+// errors are logged with this stack instead of the one of the error handler,
+// which only shows the adapter. It does not change the response.
+type StackError struct {
+	Err   error
+	Stack []byte
+}
+
+// WithStack wraps err with the current stack, nil stays nil
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StackError{Err: err, Stack: debug.Stack()}
+}
+
+func (e *StackError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StackError) Unwrap() error {
+	return e.Err
+}
+
+func errorString(err error, fallback string) string {
+	if err == nil {
+		return fallback
+	}
+	return err.Error()
+}
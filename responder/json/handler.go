@@ -0,0 +1,109 @@
+package json
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/responder"
+)
+
+// HandlerFunc is an HTTP handler that returns an error instead of writing
+// the error response itself. Use JSONResponder.Handle to adapt it.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ErrorMapper translates domain errors into the typed errors of the responder
+// package, e.g. sql.ErrNoRows into *responder.NotFoundError. It returns err
+// unchanged if it has no mapping.
+type ErrorMapper func(err error) error
+
+// WithErrorMapper returns an option that sets the mapper used by Handle.
+func WithErrorMapper(mapper ErrorMapper) Options {
+	return func(jr *JSONResponder) {
+		jr.errorMapper = mapper
+	}
+}
+
+// Handle adapts fn to an http.Handler. Errors returned by fn are passed to
+// HandleError, so a handler can simply return them.
+func (jr *JSONResponder) Handle(fn HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			jr.HandleError(w, r, err)
+		}
+	})
+}
+
+// HandleError writes the response matching err. Typed errors from the
+// responder package map to their status codes, as does *http.MaxBytesError
+// from reading a limited body. Anything else is logged with the trace ID and
+// stack and answered with a generic 500, so internal details don't leak to
+// clients. The stack of a *responder.StackError in err is preferred.
+func (jr *JSONResponder) HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	if jr.errorMapper != nil {
+		err = jr.errorMapper(err)
+	}
+
+	var (
+		notFound     *responder.NotFoundError
+		validation   *responder.ValidationError
+		conflict     *responder.ConflictError
+		unauthorized *responder.UnauthorizedError
+		badRequest   *responder.BadRequestError
+		tooLarge     *responder.TooLargeError
+		maxBytes     *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &notFound):
+		jr.NotFound(w, r, notFound)
+
+	case errors.As(err, &validation):
+		jr.FailedValidationResponse(w, r, validation.Fields)
+
+	case errors.As(err, &conflict):
+		jr.ConflictResponse(w, r, conflict)
+
+	case errors.As(err, &unauthorized):
+		jr.UnauthorizedResponse(w, r, unauthorized)
+
+	case errors.As(err, &badRequest):
+		jr.BadRequestResponse(w, r, badRequest)
+
+	case errors.As(err, &tooLarge):
+		jr.TooLargeResponse(w, r, tooLarge)
+
+	case errors.As(err, &maxBytes):
+		jr.TooLargeResponse(w, r, &responder.TooLargeError{Limit: maxBytes.Limit})
+
+	default:
+		jr.logUnexpected(r, err)
+		jr.errorResponse(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+	}
+}
+
+func (jr *JSONResponder) logUnexpected(r *http.Request, err error) {
+	stack := debug.Stack()
+	var withStack *responder.StackError
+	if errors.As(err, &withStack) {
+		stack = withStack.Stack
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("uri", r.URL.RequestURI()),
+		slog.String("stack", string(stack)),
+	}
+
+	// The per-request logger from LogRequest already carries the trace ID
+	fallback := jr.logger
+	if fallback == nil {
+		fallback = slog.Default()
+	}
+	fallback = fallback.With(slog.String("trace_id", middleware.GetTraceIDFromContext(r.Context())))
+
+	logger := middleware.LoggerFromContextOr(r.Context(), fallback)
+	logger.LogAttrs(r.Context(), slog.LevelError, err.Error(), attrs...)
+}
@@ -0,0 +1,176 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/responder"
+)
+
+func TestHandleError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"not found", &responder.NotFoundError{}, http.StatusNotFound, "the requested resource could not be found"},
+		{"conflict", &responder.ConflictError{Err: errors.New("email taken")}, http.StatusConflict, "email taken"},
+		{"unauthorized", &responder.UnauthorizedError{}, http.StatusUnauthorized, "invalid authentication credentials"},
+		{"bad request", &responder.BadRequestError{Err: errors.New("missing id")}, http.StatusBadRequest, "missing id"},
+		{"too large", &responder.TooLargeError{Limit: 10}, http.StatusRequestEntityTooLarge, "body must not be larger than 10 bytes"},
+		{"max bytes", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, "body must not be larger than 10 bytes"},
+		{"wrapped", fmt.Errorf("load user: %w", &responder.NotFoundError{Err: errors.New("no such user")}), http.StatusNotFound, "no such user"},
+		{"mapped", fmt.Errorf("query: %w", sql.ErrNoRows), http.StatusNotFound, "the requested resource could not be found"},
+		{"unexpected", errors.New("connection refused"), http.StatusInternalServerError, "the server encountered a problem and could not process your request"},
+	}
+
+	jr := New(slog.New(slog.DiscardHandler), WithErrorMapper(func(err error) error {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &responder.NotFoundError{}
+		}
+		return err
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := jr.Handle(func(w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var body struct{ Error string }
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Error != tt.message {
+				t.Errorf("error = %q, want %q", body.Error, tt.message)
+			}
+		})
+	}
+}
+
+func TestHandleErrorValidation(t *testing.T) {
+	jr := New(slog.New(slog.DiscardHandler))
+	h := jr.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("create: %w", &responder.ValidationError{Fields: map[string]string{"email": "must be set"}})
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"email":"must be set"`) {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+}
+
+func TestHandleErrorLogsUnexpected(t *testing.T) {
+	var logs bytes.Buffer
+	jr := New(slog.New(slog.NewJSONHandler(&logs, nil)))
+	h := jr.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("connection refused")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	r = r.WithContext(middleware.ContextWithLogger(r.Context(), slog.New(slog.DiscardHandler)))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if logs.Len() != 0 {
+		t.Errorf("own logger used despite per-request logger: %s", logs.String())
+	}
+
+	// Without a per-request logger the trace ID is added
+	r = httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.TraceIDKey, "trace-1"))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	for _, want := range []string{`"msg":"connection refused"`, `"trace_id":"trace-1"`, `"uri":"/users/7"`, `"stack":"goroutine `} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log lacks %s: %s", want, logs.String())
+		}
+	}
+}
+
+// loadUser fails where the stack should point to
+func loadUser() error {
+	return responder.WithStack(errors.New("connection refused"))
+}
+
+func TestHandleErrorLogsStack(t *testing.T) {
+	var logs bytes.Buffer
+	jr := New(slog.New(slog.NewJSONHandler(&logs, nil)))
+	h := jr.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("get user: %w", loadUser())
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+
+	var entry struct{ Msg, Stack string }
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not one JSON line: %v: %s", err, logs.String())
+	}
+	if entry.Msg != "get user: connection refused" {
+		t.Errorf("msg = %q", entry.Msg)
+	}
+	if !strings.Contains(entry.Stack, "loadUser") {
+		t.Errorf("stack does not point to loadUser: %s", entry.Stack)
+	}
+}
+
+func TestReadJSONErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"malformed", `{bad`, http.StatusBadRequest},
+		{"truncated", `{"name":`, http.StatusBadRequest},
+		{"wrong type", `{"name":7}`, http.StatusBadRequest},
+		{"unknown field", `{"age":7}`, http.StatusBadRequest},
+		{"empty", ``, http.StatusBadRequest},
+		{"two values", `{"name":"a"}{"name":"b"}`, http.StatusBadRequest},
+		{"too large", `{"name":"` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge},
+		{"valid", `{"name":"alice"}`, http.StatusNoContent},
+	}
+
+	jr := New(slog.New(slog.DiscardHandler), WithMaxBytes(32))
+	h := jr.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		var input struct{ Name string }
+		if err := jr.ReadJSON(w, r, &input); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
 
+	"github.com/bit8bytes/toolbox/middleware"
 	"github.com/bit8bytes/toolbox/responder"
 )
 
@@ -21,8 +23,9 @@ const (
 // JSONResponder handles JSON encoding and decoding for HTTP requests and responses.
 // It provides structured error handling and configurable request body limits.
 type JSONResponder struct {
-	logger   *slog.Logger
-	maxBytes int64
+	logger      *slog.Logger
+	maxBytes    int64
+	errorMapper ErrorMapper
 	responder.Responder
 }
 
@@ -42,8 +45,9 @@ func WithMaxBytes(b int64) Options {
 // If no options are provided, DefaultMaxBytes (1MB) is used as the request body limit.
 func New(logger *slog.Logger, opts ...Options) *JSONResponder {
 	jr := &JSONResponder{
-		logger:   logger,
-		maxBytes: DefaultMaxBytes,
+		logger:    logger,
+		maxBytes:  DefaultMaxBytes,
+		Responder: *responder.New(logger),
 	}
 
 	for _, opt := range opts {
@@ -78,6 +82,8 @@ func (jr *JSONResponder) WriteJSON(w http.ResponseWriter, status int, data respo
 // It enforces the configured maximum body size and provides detailed error messages
 // for various JSON parsing failures including syntax errors, type mismatches, and unknown fields.
 // The method ensures only a single JSON value is present in the request body.
+// Client mistakes are returned as *responder.BadRequestError and oversized
+// bodies as *responder.TooLargeError, so HandleError answers them with 400 and 413.
 func (jr *JSONResponder) ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	r.Body = http.MaxBytesReader(w, r.Body, jr.maxBytes)
 
@@ -90,29 +96,35 @@ func (jr *JSONResponder) ReadJSON(w http.ResponseWriter, r *http.Request, dst an
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
 		var maxBytesError *http.MaxBytesError
+		var badRequestError *responder.BadRequestError
+		var tooLargeError *responder.TooLargeError
 
 		switch {
+		// Already typed by the body, e.g. by the decompress middleware
+		case errors.As(err, &badRequestError), errors.As(err, &tooLargeError):
+			return err
+
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return badRequest(fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset))
 
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+			return badRequest(errors.New("body contains badly-formed JSON"))
 
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return badRequest(fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field))
 			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+			return badRequest(fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset))
 
 		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+			return badRequest(errors.New("body must not be empty"))
 
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			return badRequest(fmt.Errorf("body contains unknown key %s", fieldName))
 
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			return &responder.TooLargeError{Limit: maxBytesError.Limit}
 
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
@@ -124,12 +136,16 @@ func (jr *JSONResponder) ReadJSON(w http.ResponseWriter, r *http.Request, dst an
 
 	err = dec.Decode(&struct{}{})
 	if !errors.Is(err, io.EOF) {
-		return errors.New("body must only contain a single JSON value")
+		return badRequest(errors.New("body must only contain a single JSON value"))
 	}
 
 	return nil
 }
 
+func badRequest(err error) error {
+	return &responder.BadRequestError{Err: err}
+}
+
 // ServerErrorResponse sends a 500 Internal Server Error response with the error message.
 // It logs the error details and returns a JSON error response to the client.
 func (jr *JSONResponder) ServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
@@ -150,12 +166,30 @@ func (jr *JSONResponder) BadRequestResponse(w http.ResponseWriter, r *http.Reque
 	jr.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+// TooLargeResponse sends a 413 Content Too Large response with the error message.
+// It returns a JSON error response to the client without logging the error.
+func (jr *JSONResponder) TooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+	jr.errorResponse(w, r, http.StatusRequestEntityTooLarge, err.Error())
+}
+
 // FailedValidationResponse sends a 422 Unprocessable Entity response with validation errors.
 // The errors parameter should contain field names mapped to their validation error messages.
 func (jr *JSONResponder) FailedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	jr.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+// ConflictResponse sends a 409 Conflict response with the error message.
+// This is typically used for duplicate resources or edit conflicts.
+func (jr *JSONResponder) ConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	jr.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+// UnauthorizedResponse sends a 401 Unauthorized response with the error message.
+// Use the more specific Invalid*Response methods where they apply.
+func (jr *JSONResponder) UnauthorizedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	jr.errorResponse(w, r, http.StatusUnauthorized, err.Error())
+}
+
 // InvalidCredentialsResponse sends a 401 Unauthorized response for invalid login credentials.
 // This is typically used when username/password authentication fails.
 func (jr *JSONResponder) InvalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
@@ -184,6 +218,12 @@ func (jr *JSONResponder) InvalidCookieAuthenticationTokenResponse(w http.Respons
 }
 
 func (jr *JSONResponder) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	// Clients that negotiated plain text get the error as text
+	if mediaType, _ := r.Context().Value(middleware.MediaTypeKey).(string); strings.HasPrefix(mediaType, "text/plain") {
+		writeText(w, status, message)
+		return
+	}
+
 	env := responder.Envelope{"error": message}
 	err := jr.WriteJSON(w, status, env, nil)
 	if err != nil {
@@ -191,3 +231,23 @@ func (jr *JSONResponder) errorResponse(w http.ResponseWriter, r *http.Request, s
 		w.WriteHeader(500)
 	}
 }
+
+func writeText(w http.ResponseWriter, status int, message any) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+
+	fields, ok := message.(map[string]string)
+	if !ok {
+		fmt.Fprintln(w, message)
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s: %s\n", key, fields[key])
+	}
+}
@@ -3,6 +3,8 @@ package responder
 import (
 	"log/slog"
 	"net/http"
+
+	"github.com/bit8bytes/toolbox/middleware"
 )
 
 type Envelope map[string]any
@@ -12,11 +14,17 @@ type Responder struct {
 }
 
 func New(logger *slog.Logger) *Responder {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
 	return &Responder{
 		logger: logger,
 	}
 }
 
+// LogError logs err with request details.
+// It uses the per-request logger from LogRequest if there is one.
 func (h *Responder) LogError(r *http.Request, err error) {
 	var (
 		host   = r.Host
@@ -26,7 +34,9 @@ func (h *Responder) LogError(r *http.Request, err error) {
 		uri    = r.URL.RequestURI()
 	)
 
-	h.logger.Error(
+	logger := middleware.LoggerFromContextOr(r.Context(), h.logger)
+	logger.ErrorContext(
+		r.Context(),
 		err.Error(),
 		slog.String("host", host),
 		slog.String("proto", proto),
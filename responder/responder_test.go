@@ -0,0 +1,38 @@
+package responder
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+func TestLogError(t *testing.T) {
+	var own, request bytes.Buffer
+	res := New(slog.New(slog.NewJSONHandler(&own, nil)))
+	mw := middleware.New(slog.New(slog.NewJSONHandler(&request, nil)))
+
+	h := mw.LogRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res.LogError(r, errors.New("boom"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	if own.Len() != 0 {
+		t.Errorf("own logger used despite per-request logger: %s", own.String())
+	}
+	first, _, _ := strings.Cut(request.String(), "\n")
+	if !strings.Contains(first, `"msg":"boom"`) || !strings.Contains(first, `"trace_id":"`) {
+		t.Errorf("error not logged with the per-request logger: %s", first)
+	}
+
+	// Without LogRequest the responder's own logger is used
+	res.LogError(httptest.NewRequest(http.MethodGet, "/items", nil), errors.New("boom"))
+	if !strings.Contains(own.String(), `"msg":"boom"`) {
+		t.Errorf("own logger not used: %q", own.String())
+	}
+}
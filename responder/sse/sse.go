@@ -0,0 +1,148 @@
+// Package sse writes Server-Sent Events
+//
+// A Writer sends single events on a response, a Stream broadcasts events
+// to all connected clients with heartbeats and Last-Event-ID resumption.
+// Both flush through the toolbox wrappers, e.g. LogRequest and gzip.
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFlushNotSupported is returned by NewWriter if no writer in the
+// wrapper chain can flush, events would be buffered instead of streamed
+var ErrFlushNotSupported = errors.New("sse: response writer does not support flushing")
+
+// ErrInvalidField is returned for IDs and event names containing line breaks
+var ErrInvalidField = errors.New("sse: id and event must not contain line breaks")
+
+// Event is one Server-Sent Event
+type Event struct {
+	// Sent as Last-Event-ID when the client reconnects
+	ID string
+	// Event type, the browser dispatches "message" if empty
+	Event string
+	// Strings and byte slices are sent as they are, everything else as JSON
+	Data any
+	// Reconnection delay the client should use, 0 omits it
+	Retry time.Duration
+}
+
+// Writer writes events to a response. It is not safe for concurrent use.
+type Writer struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewWriter sets the event stream headers, sends them and returns a Writer.
+// It returns ErrFlushNotSupported before writing anything if w cannot flush.
+func NewWriter(w http.ResponseWriter) (*Writer, error) {
+	if !canFlush(w) {
+		return nil, ErrFlushNotSupported
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's WriteTimeout
+	rc.SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, rc: rc}, nil
+}
+
+// Send writes and flushes e
+func (sw *Writer) Send(e Event) error {
+	frame, err := Format(e)
+	if err != nil {
+		return err
+	}
+	return sw.write(frame)
+}
+
+// Heartbeat writes a comment line. It keeps proxies from closing idle
+// connections and detects disconnected clients.
+func (sw *Writer) Heartbeat() error {
+	return sw.write([]byte(": heartbeat\n\n"))
+}
+
+func (sw *Writer) write(frame []byte) error {
+	if _, err := sw.w.Write(frame); err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// Format encodes e in the event stream format
+func Format(e Event) ([]byte, error) {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return nil, ErrInvalidField
+	}
+
+	var data []byte
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("sse: encode data: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if e.ID != "" {
+		buf.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	if data != nil {
+		// Every line needs its own field, CRLF and CR end lines as well
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+		for line := range bytes.SplitSeq(data, []byte("\n")) {
+			buf.WriteString("data: ")
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// canFlush looks through wrappers like http.ResponseController does
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case interface{ FlushError() error }, http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
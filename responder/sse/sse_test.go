@@ -0,0 +1,141 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/gzip"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"json", Event{ID: "7", Event: "order", Data: map[string]int{"total": 3}}, "id: 7\nevent: order\ndata: {\"total\":3}\n\n"},
+		{"multiline", Event{Data: "a\nb\r\nc"}, "data: a\ndata: b\ndata: c\n\n"},
+		{"retry", Event{Retry: 2 * time.Second}, "retry: 2000\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Format(Event{ID: "1\ndata: injected"}); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("line break in id: err = %v, want ErrInvalidField", err)
+	}
+}
+
+type plainWriter struct{ header http.Header }
+
+func (w *plainWriter) Header() http.Header         { return w.header }
+func (w *plainWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *plainWriter) WriteHeader(int)             {}
+
+func TestNewWriterRequiresFlush(t *testing.T) {
+	w := middleware.NewResponseWriter(&plainWriter{header: http.Header{}})
+	if _, err := NewWriter(w); !errors.Is(err, ErrFlushNotSupported) {
+		t.Errorf("err = %v, want ErrFlushNotSupported", err)
+	}
+}
+
+// readEvent returns the data lines of the next event, skipping comments
+func readEvent(t *testing.T, r *bufio.Reader) (id, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && (id != "" || data != ""):
+			return id, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamResumeThroughMiddleware(t *testing.T) {
+	stream := NewStream(nil, &Config{Heartbeat: 10 * time.Millisecond, ReplaySize: 2, ClientBuffer: 4})
+	for _, data := range []string{"a", "b", "c"} {
+		stream.Publish(Event{Data: data})
+	}
+
+	// Compress everything so the gzip writer has to flush each event
+	mw := middleware.New(nil)
+	compress := gzip.New(mw, &gzip.Config{Level: 1})
+	srv := httptest.NewServer(mw.Chain(mw.LogRequest, compress).Then(stream))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+
+	body := bufio.NewReader(resp.Body)
+
+	// Event 1 fell out of the replay buffer, 2 was seen
+	if id, data := readEvent(t, body); id != "3" || data != "c" {
+		t.Fatalf("replayed event = %s %q, want 3 \"c\"", id, data)
+	}
+
+	stream.Publish(Event{Data: "d"})
+	if id, data := readEvent(t, body); id != "4" || data != "d" {
+		t.Fatalf("live event = %s %q, want 4 \"d\"", id, data)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for stream.Clients() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client not removed after disconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamDropsSlowClient(t *testing.T) {
+	stream := NewStream(nil, &Config{ClientBuffer: 1})
+
+	ch, _, _ := stream.subscribe("")
+	stream.Publish(Event{Data: "a"})
+	stream.Publish(Event{Data: "b"})
+
+	<-ch
+	if _, ok := <-ch; ok {
+		t.Error("slow client still subscribed")
+	}
+	if n := stream.Clients(); n != 0 {
+		t.Errorf("Clients() = %d, want 0", n)
+	}
+}
@@ -0,0 +1,236 @@
+package sse
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+)
+
+// Config holds stream configuration
+type Config struct {
+	// Interval of heartbeat comments, 0 disables them
+	Heartbeat time.Duration
+	// Reconnection delay sent to clients on connect, 0 omits it
+	Retry time.Duration
+	// Number of recent events kept for Last-Event-ID resumption
+	ReplaySize int
+	// Events queued per client. Clients that fall further behind are
+	// disconnected and resume from the replay buffer.
+	ClientBuffer int
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Heartbeat:    15 * time.Second,
+		Retry:        3 * time.Second,
+		ReplaySize:   100,
+		ClientBuffer: 16,
+	}
+}
+
+// Stream broadcasts events to all connected clients
+type Stream struct {
+	logger *slog.Logger
+	config *Config
+
+	mu      sync.Mutex
+	lastID  uint64
+	replay  []frame
+	clients map[chan []byte]struct{}
+	closed  bool
+}
+
+// frame is an encoded event, events are encoded once for all clients
+type frame struct {
+	id   string
+	data []byte
+}
+
+// NewStream creates a stream, serve it with ServeHTTP
+func NewStream(logger *slog.Logger, config *Config) *Stream {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.ClientBuffer <= 0 {
+		config.ClientBuffer = DefaultConfig().ClientBuffer
+	}
+
+	return &Stream{
+		logger:  logger,
+		config:  config,
+		clients: make(map[chan []byte]struct{}),
+	}
+}
+
+// Publish sends e to all connected clients. Events without an ID get the
+// next number of the stream, the ID is returned.
+func (s *Stream) Publish(e Event) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.ID == "" {
+		s.lastID++
+		e.ID = strconv.FormatUint(s.lastID, 10)
+	}
+
+	data, err := Format(e)
+	if err != nil {
+		return "", err
+	}
+
+	if s.config.ReplaySize > 0 {
+		if len(s.replay) == s.config.ReplaySize {
+			s.replay = append(s.replay[:0], s.replay[1:]...)
+		}
+		s.replay = append(s.replay, frame{id: e.ID, data: data})
+	}
+
+	for ch := range s.clients {
+		select {
+		case ch <- data:
+		default:
+			// Too slow, the client reconnects and resumes from the replay buffer
+			delete(s.clients, ch)
+			close(ch)
+			s.logger.Warn("sse client too slow, disconnected", slog.String("event_id", e.ID))
+		}
+	}
+	return e.ID, nil
+}
+
+// Clients returns the number of connected clients
+func (s *Stream) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Close disconnects all clients and rejects new ones. Register it with
+// http.Server.RegisterOnShutdown, Shutdown waits for open streams otherwise.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for ch := range s.clients {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+// subscribe registers a client and returns the events it missed since
+// lastEventID. An ID no longer in the buffer replays the whole buffer.
+func (s *Stream) subscribe(lastEventID string) (chan []byte, [][]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, nil, false
+	}
+
+	var missed [][]byte
+	if lastEventID != "" {
+		start := 0
+		for i, f := range s.replay {
+			if f.id == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+		for _, f := range s.replay[start:] {
+			missed = append(missed, f.data)
+		}
+	}
+
+	ch := make(chan []byte, s.config.ClientBuffer)
+	s.clients[ch] = struct{}{}
+	return ch, missed, true
+}
+
+func (s *Stream) unsubscribe(ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[ch]; ok {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
+
+// ServeHTTP streams events to the client until it disconnects or the
+// stream is closed
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	traceID := middleware.GetTraceIDFromContext(r.Context())
+
+	ch, missed, ok := s.subscribe(r.Header.Get("Last-Event-ID"))
+	if !ok {
+		s.error(w, http.StatusServiceUnavailable, "stream closed", traceID)
+		return
+	}
+	defer s.unsubscribe(ch)
+
+	sw, err := NewWriter(w)
+	if err != nil {
+		s.logger.Error("sse stream failed",
+			slog.String("trace_id", traceID),
+			slog.String("path", r.URL.Path),
+			slog.String("error", err.Error()),
+		)
+		s.error(w, http.StatusInternalServerError, "internal server error", traceID)
+		return
+	}
+
+	if s.config.Retry > 0 {
+		if err := sw.Send(Event{Retry: s.config.Retry}); err != nil {
+			return
+		}
+	}
+	for _, data := range missed {
+		if err := sw.write(data); err != nil {
+			return
+		}
+	}
+
+	var heartbeat <-chan time.Time
+	if s.config.Heartbeat > 0 {
+		ticker := time.NewTicker(s.config.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := sw.write(data); err != nil {
+				return
+			}
+		case <-heartbeat:
+			if err := sw.Heartbeat(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Stream) error(w http.ResponseWriter, status int, message, traceID string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    message,
+		"trace_id": traceID,
+	})
+}
@@ -0,0 +1,338 @@
+// Package rotate provides a log file writer with size and age based rotation
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// backupTimeFormat is appended to the file name of rotated files, always
+// in UTC so names sort in order across DST changes
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Config holds rotation configuration
+type Config struct {
+	// Rotate once the file would grow beyond this many bytes (0 disables)
+	MaxSize int64
+	// Rotate once the file is older than this (0 disables)
+	MaxAge time.Duration
+	// Number of rotated files to keep (0 keeps all)
+	MaxBackups int
+	// Gzip rotated files
+	Compress bool
+	// File mode used when creating files
+	Mode os.FileMode
+	// Called with errors of background compression and backup removal
+	// (default: logged with slog.Default)
+	OnError func(error)
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		MaxSize:    100 << 20, // 100MB
+		MaxAge:     24 * time.Hour,
+		MaxBackups: 7,
+		Compress:   true,
+		Mode:       0o644,
+	}
+}
+
+// Writer is an io.WriteCloser that writes to a file and rotates it.
+// It is safe for concurrent use.
+type Writer struct {
+	path   string
+	config *Config
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// cleanup runs compression and backup removal in the background,
+	// one rotation at a time
+	cleanup   sync.WaitGroup
+	cleanupMu sync.Mutex
+}
+
+// New opens or creates the file at path for appending
+func New(path string, config *Config) (*Writer, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Mode == 0 {
+		config.Mode = 0o644
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			slog.Error("rotate: background cleanup failed", slog.String("error", err.Error()))
+		}
+	}
+
+	w := &Writer{
+		path:   path,
+		config: config,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Write appends p to the file, rotating first if limits are exceeded
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if w.shouldRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	return w.rotate()
+}
+
+// Reopen closes and reopens the file at path.
+// Use this after an external tool like logrotate moved the file.
+// If the file can't be opened, writes continue to the old one.
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	return old.Close()
+}
+
+// ReopenOnSIGHUP reopens the file whenever the process receives SIGHUP.
+// Call the returned function to stop listening.
+func (w *Writer) ReopenOnSIGHUP(onError func(error)) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case <-sig:
+				if err := w.Reopen(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sig)
+			close(done)
+		})
+	}
+}
+
+// Close closes the file and waits for background compression
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+
+	w.cleanup.Wait()
+	return err
+}
+
+func (w *Writer) shouldRotate(n int64) bool {
+	if w.config.MaxSize > 0 && w.size > 0 && w.size+n > w.config.MaxSize {
+		return true
+	}
+	if w.config.MaxAge > 0 && time.Since(w.openedAt) > w.config.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.config.Mode)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+// rotate renames the open file and opens a new one. The old handle is only
+// closed once the new file is open, so a failed rotation keeps the writer
+// usable and the next write tries again.
+func (w *Writer) rotate() error {
+	backup := w.backupName(time.Now().UTC())
+	if err := os.Rename(w.path, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	old := w.file
+	if err := w.open(); err != nil {
+		// Put the file back so the next attempt rotates it
+		os.Rename(backup, w.path)
+		return err
+	}
+	old.Close()
+
+	w.cleanup.Add(1)
+	go func() {
+		defer w.cleanup.Done()
+		w.cleanupMu.Lock()
+		defer w.cleanupMu.Unlock()
+		if w.config.Compress {
+			if err := compress(backup, w.config.Mode); err != nil {
+				w.config.OnError(fmt.Errorf("rotate: compress %s: %w", backup, err))
+			}
+		}
+		w.removeOldBackups()
+	}()
+
+	return nil
+}
+
+// backupName returns an unused backup name for now. Rotating twice within
+// a millisecond must not overwrite the first backup.
+func (w *Writer) backupName(now time.Time) string {
+	for {
+		backup := w.path + "." + now.Format(backupTimeFormat)
+		if !exists(backup) && !exists(backup+".gz") {
+			return backup
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// Backups returns the rotated files, newest first
+func (w *Writer) Backups() ([]string, error) {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]string, 0, len(matches))
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, w.path+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+
+	// The timestamp format sorts lexically
+	slices.Sort(backups)
+	slices.Reverse(backups)
+	return backups, nil
+}
+
+func (w *Writer) removeOldBackups() {
+	if w.config.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := w.Backups()
+	if err != nil {
+		w.config.OnError(fmt.Errorf("rotate: list backups: %w", err))
+		return
+	}
+
+	for _, old := range backups[min(len(backups), w.config.MaxBackups):] {
+		if err := os.Remove(old); err != nil {
+			w.config.OnError(fmt.Errorf("rotate: %w", err))
+		}
+	}
+}
+
+func compress(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return fmt.Errorf("compress %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
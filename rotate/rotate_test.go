@@ -0,0 +1,205 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSizeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(path, &Config{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("12345678\n"))
+	// Would exceed MaxSize, so the first line moves to a backup
+	w.Write([]byte("abc\n"))
+
+	backups, _ := w.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+	if got := readFile(t, backups[0]); got != "12345678\n" {
+		t.Errorf("backup = %q", got)
+	}
+	if got := readFile(t, path); got != "abc\n" {
+		t.Errorf("current = %q", got)
+	}
+}
+
+func TestAgeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(path, &Config{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("old\n"))
+	w.openedAt = time.Now().Add(-2 * time.Hour)
+	w.Write([]byte("new\n"))
+
+	if backups, _ := w.Backups(); len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("current = %q", got)
+	}
+}
+
+func TestMaxBackupsAndCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(path, &Config{MaxBackups: 2, Compress: true, Mode: 0o600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"one\n", "two\n", "three\n"} {
+		w.Write([]byte(line))
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		// Backup names have millisecond resolution
+		time.Sleep(2 * time.Millisecond)
+	}
+	w.Close()
+
+	backups, _ := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v, want 2", backups)
+	}
+
+	// Newest first
+	for i, want := range []string{"three\n", "two\n"} {
+		if !strings.HasSuffix(backups[i], ".gz") {
+			t.Fatalf("backup %s not compressed", backups[i])
+		}
+		f, err := os.Open(backups[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(gz)
+		f.Close()
+		if string(data) != want {
+			t.Errorf("backup %d = %q, want %q", i, data, want)
+		}
+
+		info, _ := os.Stat(backups[i])
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("backup mode = %v, want 0600", info.Mode().Perm())
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	w, err := New(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// logrotate moves the file, writes go to the moved file until Reopen
+	w.Write([]byte("before\n"))
+	moved := filepath.Join(dir, "app.log.1")
+	os.Rename(path, moved)
+	w.Write([]byte("moved\n"))
+
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("after\n"))
+
+	if got := readFile(t, moved); got != "before\nmoved\n" {
+		t.Errorf("moved = %q", got)
+	}
+	if got := readFile(t, path); got != "after\n" {
+		t.Errorf("reopened = %q", got)
+	}
+}
+
+func TestFailedOpenKeepsWriting(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "app.log")
+	w, err := New(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// A file where the log directory was makes opening fail
+	moved := filepath.Join(dir, "moved")
+	os.Rename(filepath.Join(dir, "logs"), moved)
+	os.WriteFile(filepath.Join(dir, "logs"), nil, 0o644)
+
+	if err := w.Reopen(); err == nil {
+		t.Fatal("Reopen succeeded, want error")
+	}
+	if err := w.Rotate(); err == nil {
+		t.Fatal("Rotate succeeded, want error")
+	}
+	if _, err := w.Write([]byte("still here\n")); err != nil {
+		t.Fatalf("write after failed Reopen: %v", err)
+	}
+	if got := readFile(t, filepath.Join(moved, "app.log")); got != "still here\n" {
+		t.Errorf("old file = %q", got)
+	}
+}
+
+func TestBackupNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(path, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Rotations within the same millisecond must not overwrite each other
+	for _, line := range []string{"one\n", "two\n", "three\n"} {
+		w.Write([]byte(line))
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := w.Backups()
+	if len(backups) != 3 {
+		t.Fatalf("backups = %v, want 3", backups)
+	}
+	for i, want := range []string{"three\n", "two\n", "one\n"} {
+		if got := readFile(t, backups[i]); got != want {
+			t.Errorf("backup %d = %q, want %q", i, got, want)
+		}
+	}
+
+	// Names are in UTC
+	stamp := strings.TrimPrefix(backups[0], path+".")
+	at, err := time.Parse(backupTimeFormat, stamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(at); d < -time.Minute || d > time.Minute {
+		t.Errorf("backup time %s is not UTC", stamp)
+	}
+}
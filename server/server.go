@@ -0,0 +1,242 @@
+// Package server runs an http.Server with sensible timeouts and a graceful,
+// signal driven shutdown.
+//
+// On SIGINT or SIGTERM the server fails readiness, waits for the drain delay
+// so load balancers stop sending traffic, shuts down with a deadline, stops
+// background goroutines and finally runs the registered cleanup hooks.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Config holds server configuration
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// Time between failing readiness and closing listeners
+	DrainDelay time.Duration
+	// Deadline for in-flight requests and cleanup hooks
+	ShutdownTimeout time.Duration
+	// Serve TLS if both are set
+	CertFile string
+	KeyFile  string
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Addr:              ":8080",
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		DrainDelay:        5 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// Server wraps http.Server with lifecycle management
+type Server struct {
+	logger *slog.Logger
+	config *Config
+	http   *http.Server
+
+	ready atomic.Bool
+
+	// base is the parent of every request context and of background goroutines
+	base   context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	hooks []func(context.Context) error
+}
+
+// New creates a server for handler
+func New(logger *slog.Logger, handler http.Handler, config *Config) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	base, cancel := context.WithCancel(context.Background())
+
+	s := &Server{
+		logger: logger,
+		config: config,
+		base:   base,
+		cancel: cancel,
+	}
+
+	s.http = &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		BaseContext: func(net.Listener) context.Context {
+			return base
+		},
+	}
+
+	return s
+}
+
+// HTTPServer returns the underlying server for settings not covered by Config
+func (s *Server) HTTPServer() *http.Server {
+	return s.http
+}
+
+// OnShutdown registers a cleanup hook, e.g. closing a database.
+// Hooks run in reverse order of registration after the server stopped.
+func (s *Server) OnShutdown(hook func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Go runs fn in a background goroutine. Its context is canceled on
+// shutdown once in-flight requests are done, and shutdown waits for fn.
+func (s *Server) Go(fn func(ctx context.Context)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn(s.base)
+	}()
+}
+
+// Ready reports whether the server accepts traffic
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// ReadinessHandler responds 200 while ready and 503 while starting or draining
+func (s *Server) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !s.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+// Run serves until SIGINT or SIGTERM and then shuts down gracefully.
+// A second signal during shutdown terminates the process immediately.
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore the default signal handling once the first signal arrived
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return s.RunContext(ctx)
+}
+
+// RunContext serves until ctx is done and then shuts down gracefully
+func (s *Server) RunContext(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is done and then shuts down gracefully
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.config.CertFile != "" && s.config.KeyFile != "" {
+			serveErr <- s.http.ServeTLS(ln, s.config.CertFile, s.config.KeyFile)
+			return
+		}
+		serveErr <- s.http.Serve(ln)
+	}()
+
+	s.ready.Store(true)
+	s.logger.Info("server started", slog.String("addr", ln.Addr().String()))
+
+	select {
+	case err := <-serveErr:
+		s.ready.Store(false)
+		s.cancel()
+		s.wg.Wait()
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+		defer cancel()
+		return errors.Join(err, s.runHooks(ctx))
+	case <-ctx.Done():
+	}
+
+	return s.shutdown()
+}
+
+func (s *Server) shutdown() error {
+	s.ready.Store(false)
+	s.logger.Info("server draining", slog.Duration("drain_delay", s.config.DrainDelay))
+
+	// Keep serving while load balancers notice the failed readiness
+	time.Sleep(s.config.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	s.logger.Info("server shutting down")
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		s.logger.Error("server shutdown incomplete", slog.String("error", err.Error()))
+	}
+
+	// Stop background goroutines and whatever requests outlived the deadline
+	s.cancel()
+	s.wg.Wait()
+
+	err = errors.Join(err, s.runHooks(ctx))
+
+	s.logger.Info("server stopped")
+	return err
+}
+
+// runHooks runs the cleanup hooks in reverse order of registration
+func (s *Server) runHooks(ctx context.Context) error {
+	s.mu.Lock()
+	hooks := s.hooks
+	s.mu.Unlock()
+
+	var err error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if hookErr := hooks[i](ctx); hookErr != nil {
+			s.logger.Error("shutdown hook failed", slog.String("error", hookErr.Error()))
+			err = errors.Join(err, hookErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServeShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	s := New(slog.New(slog.DiscardHandler), mux, &Config{
+		DrainDelay:      100 * time.Millisecond,
+		ShutdownTimeout: 5 * time.Second,
+	})
+	mux.Handle("/ready", s.ReadinessHandler())
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	goCanceled := make(chan struct{})
+	s.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(goCanceled)
+	})
+
+	var (
+		mu    sync.Mutex
+		hooks []int
+	)
+	for i := range 3 {
+		s.OnShutdown(func(context.Context) error {
+			// Background goroutines are stopped before hooks run
+			select {
+			case <-goCanceled:
+			default:
+				t.Error("hook ran before Go goroutines stopped")
+			}
+			mu.Lock()
+			hooks = append(hooks, i)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.Serve(ctx, ln) }()
+
+	readiness := func() int {
+		resp, err := client.Get(url + "/ready")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := readiness(); code != http.StatusOK {
+		t.Fatalf("readiness = %d, want 200", code)
+	}
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := client.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(body)
+	}()
+	<-started
+
+	cancel()
+
+	// Still serving during the drain delay, but no longer ready
+	deadline := time.Now().Add(time.Second)
+	for readiness() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("readiness never flipped to 503")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	select {
+	case <-goCanceled:
+		t.Fatal("Go context canceled while requests were in flight")
+	default:
+	}
+
+	close(release)
+	if got := <-slow; got != "done" {
+		t.Errorf("in-flight request = %q, want done", got)
+	}
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Fatalf("Serve() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+
+	select {
+	case <-goCanceled:
+	default:
+		t.Error("Go context not canceled")
+	}
+	if !slices.Equal(hooks, []int{2, 1, 0}) {
+		t.Errorf("hooks ran in order %v, want [2 1 0]", hooks)
+	}
+}
+
+func TestServeErrorRunsHooks(t *testing.T) {
+	s := New(slog.New(slog.DiscardHandler), http.NotFoundHandler(), nil)
+
+	ran := false
+	hookErr := errors.New("close db")
+	s.OnShutdown(func(context.Context) error {
+		ran = true
+		return hookErr
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+
+	err = s.Serve(context.Background(), ln)
+	if err == nil {
+		t.Fatal("Serve on a closed listener succeeded")
+	}
+	if !ran {
+		t.Error("hooks not run after Serve failed")
+	}
+	if !errors.Is(err, hookErr) {
+		t.Errorf("Serve() = %v, want hook error joined", err)
+	}
+	if s.Ready() {
+		t.Error("still ready after Serve failed")
+	}
+}
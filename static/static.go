@@ -0,0 +1,323 @@
+// Package static serves files from an fs.FS, e.g. an embed.FS
+//
+// Files get strong ETags from a hash of their content. Fingerprinted
+// names like "app.3f2a9c1b.js" are cached as immutable, everything else is
+// revalidated. A "name.gz" sidecar is served instead of "name" to clients
+// that accept gzip. The gzip middleware leaves files with a sidecar and range
+// requests alone, other files may be compressed by it.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/gzip"
+)
+
+// Config holds static file configuration
+type Config struct {
+	// File served for directories
+	Index string
+	// Serve Index for unknown paths without a file extension, so client
+	// side routes of a single page application load the app
+	SPA bool
+	// List directories without an Index file
+	Listing bool
+	// Cache lifetime of files that are not fingerprinted, 0 means they are
+	// revalidated on every use
+	MaxAge time.Duration
+	// Reports whether a file name contains a content hash, such files are
+	// cached for a year as immutable (default: Fingerprinted)
+	Fingerprinted func(name string) bool
+}
+
+// DefaultConfig serves index.html for directories without listings
+func DefaultConfig() *Config {
+	return &Config{
+		Index:         "index.html",
+		Fingerprinted: Fingerprinted,
+	}
+}
+
+// Handler serves files from an fs.FS
+type Handler struct {
+	fsys   fs.FS
+	config *Config
+	// ETags by file name, see etagFor
+	etags sync.Map
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// New creates a static file handler. For an embed.FS use fs.Sub to serve
+// a subdirectory:
+//
+//	assets, _ := fs.Sub(embedded, "dist")
+//	mux.Handle("/assets/", http.StripPrefix("/assets", static.New(assets, nil)))
+func New(fsys fs.FS, config *Config) *Handler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Fingerprinted == nil {
+		config.Fingerprinted = Fingerprinted
+	}
+
+	return &Handler{fsys: fsys, config: config}
+}
+
+// ServeHTTP serves the file named by the request path
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.error(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	info, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		if h.config.SPA && path.Ext(name) == "" {
+			h.serveFile(w, r, h.config.Index, false)
+			return
+		}
+		h.error(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	if info.IsDir() {
+		// Relative links in the index need the trailing slash. The
+		// Location is relative so it also works behind http.StripPrefix.
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			w.Header().Set("Location", path.Base(r.URL.Path)+"/")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+
+		index := path.Join(name, h.config.Index)
+		if _, err := fs.Stat(h.fsys, index); err == nil {
+			h.serveFile(w, r, index, false)
+			return
+		}
+		if h.config.Listing {
+			h.list(w, r, name)
+			return
+		}
+		h.error(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	h.serveFile(w, r, name, h.config.Fingerprinted(name))
+}
+
+// serveFile serves name or its gzip sidecar
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string, immutable bool) {
+	header := w.Header()
+
+	// Ranges refer to the file as stored
+	if r.Header.Get("Range") != "" {
+		gzip.Bypass(w)
+	}
+
+	served := name
+	if _, err := fs.Stat(h.fsys, name+".gz"); err == nil {
+		// The sidecar is the compressed variant, or the client refused it
+		gzip.Bypass(w)
+
+		// The gzip middleware may have added it already
+		if !varies(header, "Accept-Encoding") {
+			header.Add("Vary", "Accept-Encoding")
+		}
+		if acceptsGzip(r) {
+			served = name + ".gz"
+		}
+	}
+
+	f, err := h.fsys.Open(served)
+	if err != nil {
+		h.error(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		h.error(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+
+	etag, err := h.etagFor(served, info, content)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	if served != name {
+		header.Set("Content-Encoding", "gzip")
+	}
+	// Type of the original, not of the sidecar
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+	header.Set("ETag", etag)
+
+	switch {
+	case immutable:
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	case h.config.MaxAge > 0:
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.config.MaxAge.Seconds())))
+	default:
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	// Handles Range, HEAD and the conditional headers. embed.FS has no
+	// modification times, so caching relies on the ETag.
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etagFor returns the ETag of name, computing it on first use. Entries are
+// recomputed if the size or modification time changed, e.g. for os.DirFS.
+func (h *Handler) etagFor(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if v, ok := h.etags.Load(name); ok {
+		entry := v.(*etagEntry)
+		if entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+			return entry.etag, nil
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:18]) + `"`
+	h.etags.Store(name, &etagEntry{modTime: info.ModTime(), size: info.Size(), etag: etag})
+	return etag, nil
+}
+
+// list writes a minimal HTML directory listing
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	fmt.Fprintln(w, "<!doctype html>\n<pre>")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := (&url.URL{Path: entryName}).String()
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(link), html.EscapeString(entryName))
+	}
+	fmt.Fprintln(w, "</pre>")
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":    message,
+		"trace_id": middleware.GetTraceIDFromContext(r.Context()),
+	})
+}
+
+// Fingerprinted reports whether the last dot or dash separated part of the
+// name before the extension looks like a content hash of at least 8
+// characters containing a digit, e.g. "app.3f2a9c1b.js" or "index-B7x2kQ9a.js"
+func Fingerprinted(name string) bool {
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, ".gz")
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	i := strings.LastIndexAny(base, ".-")
+	if i < 0 {
+		return false
+	}
+	hash := base[i+1:]
+	if len(hash) < 8 {
+		return false
+	}
+
+	digit := false
+	for _, c := range hash {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		default:
+			return false
+		}
+	}
+	return digit
+}
+
+// varies reports whether the Vary header already lists name
+func varies(header http.Header, name string) bool {
+	for _, value := range header.Values("Vary") {
+		for field := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for part := range strings.SplitSeq(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		_, q, _ := strings.Cut(params, "q=")
+		if qv, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && qv == 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package static
+
+import (
+	"bytes"
+	stdgzip "compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bit8bytes/toolbox/middleware"
+	"github.com/bit8bytes/toolbox/middleware/gzip"
+)
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	gz := stdgzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func testFS() fstest.MapFS {
+	js := strings.Repeat("console.log(1);\n", 200)
+	return fstest.MapFS{
+		"index.html":               {Data: []byte("<!doctype html><title>app</title>")},
+		"app.3f2a9c1b.js":          {Data: []byte(js)},
+		"app.3f2a9c1b.js.gz":       {Data: gzipped(js)},
+		"style.css":                {Data: []byte(strings.Repeat("body{}\n", 500))},
+		"docs/guide.txt":           {Data: []byte("guide")},
+		"images/logo-B7x2kQ9a.svg": {Data: []byte("<svg/>")},
+	}
+}
+
+func serve(h http.Handler, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServe(t *testing.T) {
+	mw := middleware.New(nil)
+	h := gzip.Handler(mw)(New(testFS(), nil))
+
+	tests := []struct {
+		name         string
+		path         string
+		header       map[string]string
+		wantStatus   int
+		wantEncoding string
+		wantCache    string
+		wantType     string
+	}{
+		{"index", "/", nil, http.StatusOK, "", "no-cache", "text/html; charset=utf-8"},
+		{"sidecar", "/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip"}, http.StatusOK, "gzip", "public, max-age=31536000, immutable", "text/javascript; charset=utf-8"},
+		{"sidecar refused", "/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip;q=0"}, http.StatusOK, "", "public, max-age=31536000, immutable", "text/javascript; charset=utf-8"},
+		// Without a sidecar the gzip middleware compresses
+		{"no sidecar", "/style.css", map[string]string{"Accept-Encoding": "gzip"}, http.StatusOK, "gzip", "no-cache", "text/css; charset=utf-8"},
+		{"no sidecar range", "/style.css", map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-9"}, http.StatusPartialContent, "", "no-cache", "text/css; charset=utf-8"},
+		{"dash fingerprint", "/images/logo-B7x2kQ9a.svg", nil, http.StatusOK, "", "public, max-age=31536000, immutable", "image/svg+xml"},
+		{"no listing", "/docs/", nil, http.StatusNotFound, "", "", "application/json"},
+		{"missing", "/missing", nil, http.StatusNotFound, "", "", "application/json"},
+		{"traversal", "/../static.go", nil, http.StatusNotFound, "", "", "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.path, tt.header)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestSidecarContent(t *testing.T) {
+	fsys := testFS()
+	h := New(fsys, nil)
+
+	rec := serve(h, "/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip"})
+	gz, err := stdgzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if !bytes.Equal(body, fsys["app.3f2a9c1b.js"].Data) {
+		t.Error("decompressed sidecar differs from original")
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+}
+
+func TestVaryBehindGzip(t *testing.T) {
+	h := gzip.Handler(middleware.New(nil))(New(testFS(), nil))
+
+	rec := serve(h, "/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip"})
+	if got := rec.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want a single Accept-Encoding", got)
+	}
+}
+
+func TestCompressedBehindGzip(t *testing.T) {
+	fsys := testFS()
+	h := gzip.Handler(middleware.New(nil))(New(fsys, nil))
+
+	rec := serve(h, "/style.css", map[string]string{"Accept-Encoding": "gzip"})
+	gz, err := stdgzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if !bytes.Equal(body, fsys["style.css"].Data) {
+		t.Error("decompressed response differs from original")
+	}
+
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, "W/") {
+		t.Fatalf("ETag = %q, want a weak ETag for the compressed response", etag)
+	}
+	rec = serve(h, "/style.css", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304", rec.Code)
+	}
+}
+
+func TestETag(t *testing.T) {
+	h := New(testFS(), nil)
+
+	plain := serve(h, "/app.3f2a9c1b.js", nil).Header().Get("ETag")
+	encoded := serve(h, "/app.3f2a9c1b.js", map[string]string{"Accept-Encoding": "gzip"}).Header().Get("ETag")
+	if plain == "" || plain == encoded {
+		t.Fatalf("ETags = %q and %q, want distinct strong ETags per encoding", plain, encoded)
+	}
+
+	rec := serve(h, "/app.3f2a9c1b.js", map[string]string{"If-None-Match": plain})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304", rec.Code)
+	}
+}
+
+func TestSPA(t *testing.T) {
+	h := New(testFS(), &Config{Index: "index.html", SPA: true})
+
+	rec := serve(h, "/settings/profile", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>app</title>") {
+		t.Errorf("client route: status = %d, body = %q", rec.Code, rec.Body)
+	}
+
+	// Missing assets stay 404s
+	if rec := serve(h, "/missing.js", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing asset: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestListing(t *testing.T) {
+	h := New(testFS(), &Config{Index: "index.html", Listing: true})
+
+	rec := serve(h, "/docs", nil)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "docs/" {
+		t.Fatalf("redirect: status = %d, Location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = serve(h, "/docs/", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<a href="guide.txt">`) {
+		t.Errorf("listing: status = %d, body = %q", rec.Code, rec.Body)
+	}
+}
+
+func TestFingerprinted(t *testing.T) {
+	tests := map[string]bool{
+		"app.3f2a9c1b.js":          true,
+		"assets/index-B7x2kQ9a.js": true,
+		"chunk.3f2a9c1b.js.gz":     true,
+		"app.js":                   false,
+		"index-settings.js":        false,
+		"jquery-3.7.1.min.js":      false,
+	}
+	for name, want := range tests {
+		if got := Fingerprinted(name); got != want {
+			t.Errorf("Fingerprinted(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const scopeName = "github.com/bit8bytes/toolbox/tracing"
+
+// The types below mirror the OTLP/HTTP JSON encoding of
+// ExportTraceServiceRequest. Trace and span ids are hex encoded and
+// 64 bit integers are encoded as strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (t *Tracer) export(spans []*Span) error {
+	body, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (t *Tracer) encode(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.context.TraceID.String(),
+			SpanID:            s.context.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        encodeAttrs(s.attrs),
+			Status:            otlpStatus{Code: s.status, Message: s.statusDesc},
+		}
+		if s.parentID.IsValid() {
+			span.ParentSpanID = s.parentID.String()
+		}
+		for _, e := range s.events {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: unixNano(e.Time),
+				Name:         e.Name,
+				Attributes:   encodeAttrs(e.Attrs),
+			})
+		}
+		s.mu.Unlock()
+
+		encoded = append(encoded, span)
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: encodeAttrs([]slog.Attr{slog.String("service.name", t.config.ServiceName)}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scopeName},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func encodeAttrs(attrs []slog.Attr) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, encodeAttr("", attr)...)
+	}
+	return kvs
+}
+
+// encodeAttr flattens slog groups into dotted keys
+func encodeAttr(prefix string, attr slog.Attr) []otlpKeyValue {
+	key := attr.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+
+	value := attr.Value.Resolve()
+	var v otlpValue
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		var kvs []otlpKeyValue
+		for _, a := range value.Group() {
+			kvs = append(kvs, encodeAttr(key, a)...)
+		}
+		return kvs
+	case slog.KindBool:
+		b := value.Bool()
+		v.BoolValue = &b
+	case slog.KindInt64:
+		i := strconv.FormatInt(value.Int64(), 10)
+		v.IntValue = &i
+	case slog.KindUint64:
+		i := strconv.FormatUint(value.Uint64(), 10)
+		v.IntValue = &i
+	case slog.KindFloat64:
+		f := value.Float64()
+		v.DoubleValue = &f
+	case slog.KindDuration:
+		i := strconv.FormatInt(value.Duration().Nanoseconds(), 10)
+		v.IntValue = &i
+	default:
+		s := value.String()
+		v.StringValue = &s
+	}
+
+	return []otlpKeyValue{{Key: key, Value: v}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
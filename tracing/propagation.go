@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header name
+const TraceparentHeader = "traceparent"
+
+// Traceparent formats sc as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+// Example: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// Version 00 has exactly four fields, later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	traceID, ok := ParseTraceID(parts[1])
+	if !ok {
+		return sc, false
+	}
+
+	if len(parts[2]) != 16 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+
+	if len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	sc.TraceID = traceID
+	sc.Sampled = flags[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	return sc, true
+}
+
+// ParseTraceID parses a 32 character hex trace id
+func ParseTraceID(value string) (TraceID, bool) {
+	var id TraceID
+
+	if len(value) != 32 {
+		return id, false
+	}
+	if _, err := hex.Decode(id[:], []byte(value)); err != nil {
+		return TraceID{}, false
+	}
+
+	return id, id.IsValid()
+}
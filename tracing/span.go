@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SpanKind describes the relationship of a span to its parent
+// Values match the OTLP enum
+type SpanKind int
+
+const (
+	KindUnspecified SpanKind = iota
+	KindInternal
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+// StatusCode is the outcome of a span
+// Values match the OTLP enum
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// StartOption configures a span when it is started
+type StartOption func(*Span)
+
+// WithKind sets the span kind
+func WithKind(kind SpanKind) StartOption {
+	return func(s *Span) {
+		s.kind = kind
+	}
+}
+
+// WithAttributes sets attributes when the span is started
+func WithAttributes(attrs ...slog.Attr) StartOption {
+	return func(s *Span) {
+		s.attrs = append(s.attrs, attrs...)
+	}
+}
+
+// Event is a timestamped annotation on a span
+type Event struct {
+	Name  string
+	Time  time.Time
+	Attrs []slog.Attr
+}
+
+// Span is a single timed operation within a trace.
+// A nil *Span is valid and ignores all calls.
+type Span struct {
+	tracer   *Tracer
+	context  SpanContext
+	parentID SpanID
+	kind     SpanKind
+
+	mu         sync.Mutex
+	name       string
+	start      time.Time
+	end        time.Time
+	attrs      []slog.Attr
+	events     []Event
+	status     StatusCode
+	statusDesc string
+	ended      bool
+}
+
+// SpanContext returns the identifiers used for propagation
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetName replaces the span name, e.g. once the route is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.name = name
+	}
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...slog.Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.attrs = append(s.attrs, attrs...)
+	}
+}
+
+// AddEvent records a named event at the current time
+func (s *Span) AddEvent(name string, attrs ...slog.Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.events = append(s.events, Event{Name: name, Time: time.Now(), Attrs: attrs})
+	}
+}
+
+// SetStatus sets the span outcome
+func (s *Span) SetStatus(code StatusCode, description string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.status = code
+		s.statusDesc = description
+	}
+}
+
+// RecordError adds an exception event and marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.AddEvent("exception", slog.String("exception.message", err.Error()))
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and queues it for export.
+// Calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.tracer != nil {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteParent makes sc the parent of the next span started from
+// ctx, e.g. a span context extracted from an incoming traceparent header
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start creates a child of the span in ctx using the same tracer.
+// Without a span in ctx it returns ctx and a nil span, which is safe to use.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil || parent.tracer == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, opts...)
+}
+
+func parentFromContext(ctx context.Context) (SpanContext, bool) {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.context, true
+	}
+	if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok && sc.IsValid() {
+		return sc, true
+	}
+	return SpanContext{}, false
+}
@@ -0,0 +1,286 @@
+// Package tracing provides lightweight distributed tracing spans.
+//
+// Spans are collected in memory and batch-exported as OTLP/HTTP JSON to a
+// collector, without depending on the OpenTelemetry SDK.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds tracer configuration
+type Config struct {
+	// Service name reported as the service.name resource attribute
+	ServiceName string
+	// OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces
+	// Spans are created but not exported if empty
+	Endpoint string
+	// Extra headers sent with every export, e.g. authorization
+	Headers map[string]string
+	// Maximum number of spans per export request
+	BatchSize int
+	// Maximum time a span waits in the queue before export
+	FlushInterval time.Duration
+	// Maximum number of queued spans, newer spans are dropped when full
+	QueueSize int
+	// HTTP client used for exporting
+	Client *http.Client
+}
+
+// DefaultConfig returns sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		ServiceName:   "unknown_service",
+		Endpoint:      "http://localhost:4318/v1/traces",
+		BatchSize:     512,
+		FlushInterval: 5 * time.Second,
+		QueueSize:     2048,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Tracer creates spans and exports them in batches
+type Tracer struct {
+	logger  *slog.Logger
+	config  *Config
+	queue   chan *Span
+	flush   chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// New creates a tracer and starts its background exporter.
+// Call Shutdown to flush remaining spans before the program exits.
+func New(logger *slog.Logger, config *Config) *Tracer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	defaults := DefaultConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Client == nil {
+		config.Client = defaults.Client
+	}
+
+	t := &Tracer{
+		logger:  logger,
+		config:  config,
+		queue:   make(chan *Span, config.QueueSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go t.run()
+
+	return t
+}
+
+// Start creates a span. If ctx carries a span or a remote parent the new
+// span becomes its child, otherwise a new trace is started.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   KindInternal,
+		start:  time.Now(),
+	}
+
+	if parent, ok := parentFromContext(ctx); ok {
+		s.context.TraceID = parent.TraceID
+		s.parentID = parent.SpanID
+		s.context.Sampled = parent.Sampled
+	} else {
+		s.context.TraceID = newTraceID()
+		s.context.Sampled = true
+	}
+	s.context.SpanID = newSpanID()
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return ContextWithSpan(ctx, s), s
+}
+
+// Flush exports all queued spans and waits until done or ctx expires
+func (t *Tracer) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+
+	select {
+	case t.flush <- ack:
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the exporter after exporting all queued spans.
+// Spans ended after Shutdown are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.done) })
+
+	select {
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of spans dropped because the queue was full
+func (t *Tracer) Dropped() int64 {
+	return t.dropped.Load()
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	if !s.context.Sampled || t.config.Endpoint == "" {
+		return
+	}
+
+	select {
+	case <-t.done:
+		t.dropped.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case t.queue <- s:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(t.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.config.BatchSize)
+
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			t.logger.Error("trace export failed",
+				slog.Int("spans", len(batch)),
+				slog.String("error", err.Error()),
+			)
+		}
+		batch = make([]*Span, 0, t.config.BatchSize)
+	}
+
+	drain := func() {
+		for {
+			select {
+			case s := <-t.queue:
+				batch = append(batch, s)
+				if len(batch) >= t.config.BatchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.config.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-t.flush:
+			drain()
+			close(ack)
+		case <-t.done:
+			drain()
+			return
+		}
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the lowercase hex encoding
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the id is not all zeros
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the lowercase hex encoding
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the id is not all zeros
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span that propagates across boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both trace and span id are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
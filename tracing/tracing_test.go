@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	var req otlpRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var spans []otlpSpan
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func newTestTracer(t *testing.T, c *collector, batchSize int) *Tracer {
+	t.Helper()
+
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	config := DefaultConfig()
+	config.ServiceName = "test"
+	config.Endpoint = srv.URL + "/v1/traces"
+	config.FlushInterval = time.Hour
+	config.BatchSize = batchSize
+	config.Headers = map[string]string{"Authorization": "Bearer secret"}
+
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), config)
+}
+
+func TestExportParentAndChild(t *testing.T) {
+	c := &collector{}
+	tracer := newTestTracer(t, c, 10)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", WithKind(KindServer))
+	_, child := Start(ctx, "child", WithAttributes(slog.Int("rows", 3)))
+	child.AddEvent("cache miss", slog.String("key", "user:1"))
+	child.End()
+	parent.SetStatus(StatusError, "boom")
+	parent.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	spans := c.spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	got, want := spans[0], spans[1]
+	if got.Name != "child" || want.Name != "parent" {
+		t.Fatalf("Unexpected span order: %q, %q", got.Name, want.Name)
+	}
+	if got.TraceID != want.TraceID {
+		t.Errorf("Child trace id %s, want %s", got.TraceID, want.TraceID)
+	}
+	if got.ParentSpanID != want.SpanID {
+		t.Errorf("Child parent id %s, want %s", got.ParentSpanID, want.SpanID)
+	}
+	if want.Kind != KindServer {
+		t.Errorf("Expected server kind, got %d", want.Kind)
+	}
+	if want.Status.Code != StatusError {
+		t.Errorf("Expected error status, got %d", want.Status.Code)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0].Key != "rows" || *got.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("Unexpected attributes: %+v", got.Attributes)
+	}
+	if len(got.Events) != 1 || got.Events[0].Name != "cache miss" {
+		t.Errorf("Unexpected events: %+v", got.Events)
+	}
+
+	if auth := c.headers[0].Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Expected auth header, got %q", auth)
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	c := &collector{}
+	tracer := newTestTracer(t, c, 2)
+
+	for range 5 {
+		_, span := tracer.Start(context.Background(), "op")
+		span.End()
+	}
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if n := len(c.spans()); n != 5 {
+		t.Errorf("Expected 5 spans, got %d", n)
+	}
+
+	tracer.Shutdown(context.Background())
+}
+
+func TestRemoteParent(t *testing.T) {
+	tracer := New(nil, &Config{})
+	defer tracer.Shutdown(context.Background())
+
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatal("ParseTraceparent() failed")
+	}
+
+	ctx := ContextWithRemoteParent(context.Background(), sc)
+	_, span := tracer.Start(ctx, "op")
+
+	if span.SpanContext().TraceID != sc.TraceID {
+		t.Error("Span should continue the remote trace")
+	}
+	if span.parentID != sc.SpanID {
+		t.Error("Remote span should be the parent")
+	}
+	if got := span.SpanContext().Traceparent(); got[:36] != "00-4bf92f3577b34da6a3ce929d0e0e4736-" {
+		t.Errorf("Unexpected traceparent %q", got)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"short", "00-4bf92f35-00f067aa0ba902b7-01", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ParseTraceparent(tt.value); ok != tt.ok {
+				t.Errorf("ParseTraceparent(%q) = %v, want %v", tt.value, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNilSpan(t *testing.T) {
+	ctx, span := Start(context.Background(), "orphan")
+	if span != nil {
+		t.Fatal("Expected nil span without a parent")
+	}
+
+	// Must not panic
+	span.SetAttributes(slog.String("key", "value"))
+	span.AddEvent("event")
+	span.RecordError(io.EOF)
+	span.End()
+
+	if SpanFromContext(ctx) != nil {
+		t.Error("Context should not carry a span")
+	}
+}